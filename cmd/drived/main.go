@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/StollD/proton-drive/daemon"
+	"github.com/StollD/proton-drive/internal/config"
+)
+
+func main() {
+	config := &config.Config{}
+
+	flags := flag.NewFlagSet("drived", flag.ExitOnError)
+	config.Register(flags)
+
+	socket := flags.String("socket", "", "unix socket to listen on (default: drived.sock in the config directory)")
+
+	_ = flags.Parse(os.Args[1:])
+
+	if *socket == "" {
+		*socket = config.SocketPath()
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	err := run(ctx, config, *socket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "drived: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, config *config.Config, socket string) error {
+	session, err := config.OpenSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Remove a stale socket from a previous run
+	_ = os.Remove(socket)
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = os.Remove(socket)
+	}()
+
+	// The socket grants full access to the drive, so only the owner may connect
+	err = os.Chmod(socket, 0600)
+	if err != nil {
+		_ = listener.Close()
+		return err
+	}
+
+	return daemon.NewServer(session).Serve(ctx, listener)
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	pathlib "path"
+	"sort"
+	"time"
+
+	drive "github.com/StollD/proton-drive"
+	"github.com/StollD/proton-drive/daemon"
+	"github.com/StollD/proton-drive/internal/config"
+)
+
+const (
+	timeFormat = "2006-01-02 15:04"
+)
+
+// optionalPath returns the only positional argument, or the root folder if there is none.
+func optionalPath(flags *flag.FlagSet) (string, error) {
+	switch flags.NArg() {
+	case 0:
+		return "/", nil
+	case 1:
+		return flags.Arg(0), nil
+	}
+
+	return "", ErrUsage
+}
+
+func sortedChildren(link *drive.Link) []*drive.Link {
+	children := link.Children().ToSlice()
+
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Name() < children[j].Name()
+	})
+
+	return children
+}
+
+func runLs(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("ls", flag.ExitOnError)
+	long := flags.Bool("l", false, "show type, size and modification time")
+
+	_ = flags.Parse(args)
+
+	path, err := optionalPath(flags)
+	if err != nil {
+		return err
+	}
+
+	session, err := config.OpenSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	link, err := lookup(session, path)
+	if err != nil {
+		return err
+	}
+
+	links := []*drive.Link{link}
+	if link.IsDir() {
+		links = sortedChildren(link)
+	}
+
+	if jsonOutput {
+		return printJSON(entries(links))
+	}
+
+	for _, link := range links {
+		name := link.Name()
+		if link.IsDir() {
+			name += "/"
+		}
+
+		if !*long {
+			fmt.Println(name)
+			continue
+		}
+
+		kind := "-"
+		if link.IsDir() {
+			kind = "d"
+		}
+
+		fmt.Printf("%s %12d %s %s\n", kind, link.Size(), link.ModificationTime().Format(timeFormat), name)
+	}
+
+	return nil
+}
+
+type treeNode struct {
+	*daemon.Entry
+	Children []*treeNode `json:"children,omitempty"`
+}
+
+func newTreeNode(link *drive.Link) *treeNode {
+	node := &treeNode{Entry: entry(link)}
+
+	for _, child := range sortedChildren(link) {
+		node.Children = append(node.Children, newTreeNode(child))
+	}
+
+	return node
+}
+
+func runTree(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("tree", flag.ExitOnError)
+
+	_ = flags.Parse(args)
+
+	path, err := optionalPath(flags)
+	if err != nil {
+		return err
+	}
+
+	session, err := config.OpenSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	link, err := lookup(session, path)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		return printJSON(newTreeNode(link))
+	}
+
+	fmt.Println(link.Path())
+	printTree(link, "")
+
+	return nil
+}
+
+func printTree(link *drive.Link, indent string) {
+	children := sortedChildren(link)
+
+	for i, child := range children {
+		branch, next := "├── ", "│   "
+		if i == len(children)-1 {
+			branch, next = "└── ", "    "
+		}
+
+		name := child.Name()
+		if child.IsDir() {
+			name += "/"
+		}
+
+		fmt.Println(indent + branch + name)
+
+		if child.IsDir() {
+			printTree(child, indent+next)
+		}
+	}
+}
+
+func runStat(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("stat", flag.ExitOnError)
+
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return ErrUsage
+	}
+
+	session, err := config.OpenSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	link, err := lookup(session, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	info := entry(link)
+
+	if jsonOutput {
+		return printJSON(info)
+	}
+
+	fmt.Printf("Path:      %s\n", info.Path)
+	fmt.Printf("ID:        %s\n", info.ID)
+	fmt.Printf("Type:      %s\n", info.Type)
+
+	if link.IsFile() {
+		fmt.Printf("Size:      %d\n", info.Size)
+		fmt.Printf("MIME type: %s\n", info.MIMEType)
+		fmt.Printf("Revision:  %s\n", info.RevisionID)
+		fmt.Printf("SHA1:      %s\n", info.Hash)
+	}
+
+	fmt.Printf("Created:   %s\n", info.Created.Format(timeFormat))
+	fmt.Printf("Modified:  %s\n", info.Modified.Format(timeFormat))
+
+	return nil
+}
+
+func runFind(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("find", flag.ExitOnError)
+	name := flags.String("name", "", "only show links whose name matches a shell pattern")
+	kind := flags.String("type", "", "only show files (f) or folders (d)")
+
+	_ = flags.Parse(args)
+
+	path, err := optionalPath(flags)
+	if err != nil {
+		return err
+	}
+
+	if *kind != "" && *kind != "f" && *kind != "d" {
+		return ErrUsage
+	}
+
+	_, err = pathlib.Match(*name, "")
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUsage, err)
+	}
+
+	session, err := config.OpenSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	root, err := lookup(session, path)
+	if err != nil {
+		return err
+	}
+
+	matches := []*drive.Link{}
+
+	var walk func(link *drive.Link)
+	walk = func(link *drive.Link) {
+		typeOK := *kind == "" || (*kind == "d") == link.IsDir()
+		nameOK := *name == ""
+
+		if !nameOK {
+			nameOK, _ = pathlib.Match(*name, link.Name())
+		}
+
+		if typeOK && nameOK {
+			matches = append(matches, link)
+		}
+
+		for _, child := range sortedChildren(link) {
+			walk(child)
+		}
+	}
+
+	walk(root)
+
+	if jsonOutput {
+		return printJSON(entries(matches))
+	}
+
+	for _, link := range matches {
+		fmt.Println(link.Path())
+	}
+
+	return nil
+}
+
+type usage struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	Files   int    `json:"files"`
+	Folders int    `json:"folders"`
+}
+
+func (self *usage) add(link *drive.Link) {
+	if link.IsDir() {
+		self.Folders++
+	} else {
+		self.Files++
+		self.Size += link.Size()
+	}
+
+	for child := range link.Children().Iter() {
+		self.add(child)
+	}
+}
+
+// runDu prints the size of every child of a folder, followed by the total.
+func runDu(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("du", flag.ExitOnError)
+	human := flags.Bool("h", false, "print sizes in powers of 1024 (e.g. 1.5M)")
+
+	_ = flags.Parse(args)
+
+	path, err := optionalPath(flags)
+	if err != nil {
+		return err
+	}
+
+	session, err := config.OpenSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	root, err := lookup(session, path)
+	if err != nil {
+		return err
+	}
+
+	children := []*usage{}
+
+	if root.IsDir() {
+		for _, child := range sortedChildren(root) {
+			total := &usage{Path: child.Path()}
+			total.add(child)
+
+			children = append(children, total)
+		}
+	}
+
+	total := &usage{Path: root.Path()}
+	total.add(root)
+
+	if jsonOutput {
+		return printJSON(map[string]any{
+			"total":    total,
+			"children": children,
+		})
+	}
+
+	for _, child := range append(children, total) {
+		fmt.Printf("%s\t%s\n", formatSize(child.Size, *human), child.Path)
+	}
+
+	return nil
+}
+
+type device struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Path     string    `json:"path"`
+	LastSync time.Time `json:"last_sync"`
+}
+
+// runDevices lists the computers that the desktop clients back up, and where their files can be found.
+func runDevices(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("devices", flag.ExitOnError)
+
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		return ErrUsage
+	}
+
+	// Device shares are hidden unless a folder is given, listing them needs one
+	if config.DevicesPath == "" {
+		config.DevicesPath = "/Computers"
+	}
+
+	session, err := config.OpenSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	devices := []*device{}
+
+	for _, dev := range session.Devices() {
+		devices = append(devices, &device{
+			ID:       dev.ID(),
+			Name:     dev.Name(),
+			Path:     dev.Root().Path(),
+			LastSync: dev.LastSync(),
+		})
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Path < devices[j].Path
+	})
+
+	if jsonOutput {
+		return printJSON(devices)
+	}
+
+	for _, dev := range devices {
+		fmt.Printf("%s  %s\t%s\n", dev.LastSync.Format(timeFormat), dev.Name, dev.Path)
+	}
+
+	return nil
+}
+
+type sharedFolder struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Owner    string `json:"owner"`
+	Path     string `json:"path"`
+	ReadOnly bool   `json:"read_only"`
+}
+
+// runShared lists the folders other users shared with this one.
+func runShared(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("shared", flag.ExitOnError)
+
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		return ErrUsage
+	}
+
+	// Shares of other users are hidden unless a folder is given, listing them needs one
+	if config.SharedPath == "" {
+		config.SharedPath = "/Shared"
+	}
+
+	session, err := config.OpenSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	folders := []*sharedFolder{}
+
+	for _, folder := range session.SharedWithMe() {
+		folders = append(folders, &sharedFolder{
+			ID:       folder.ID(),
+			Name:     folder.Name(),
+			Owner:    folder.Owner(),
+			Path:     folder.Root().Path(),
+			ReadOnly: folder.ReadOnly(),
+		})
+	}
+
+	sort.Slice(folders, func(i, j int) bool {
+		return folders[i].Path < folders[j].Path
+	})
+
+	if jsonOutput {
+		return printJSON(folders)
+	}
+
+	for _, folder := range folders {
+		mode := "rw"
+		if folder.ReadOnly {
+			mode = "ro"
+		}
+
+		fmt.Printf("%s  %s\t%s\t%s\n", mode, folder.Owner, folder.Name, folder.Path)
+	}
+
+	return nil
+}
+
+// runPhotos lists the photos stream, newest first.
+func runPhotos(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("photos", flag.ExitOnError)
+
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		return ErrUsage
+	}
+
+	// The photos share is hidden unless a folder is given, listing them needs one
+	if config.PhotosPath == "" {
+		config.PhotosPath = "/Photos"
+	}
+
+	session, err := config.OpenSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	photos := session.Photos()
+
+	if jsonOutput {
+		return printJSON(entries(photos))
+	}
+
+	for _, photo := range photos {
+		fmt.Printf("%s %12d %s\n", photo.ModificationTime().Format(timeFormat), photo.Size(), photo.Path())
+	}
+
+	return nil
+}
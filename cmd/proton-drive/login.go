@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	drive "github.com/StollD/proton-drive"
+	"github.com/StollD/proton-drive/internal/config"
+	"golang.org/x/term"
+)
+
+// runLogin logs in and stores the session tokens, which the other commands pick up. Credentials that aren't set
+// in the environment are asked for interactively.
+func runLogin(ctx context.Context, config *config.Config, args []string) error {
+	credentials := config.Credentials()
+
+	flags := flag.NewFlagSet("login", flag.ExitOnError)
+	flags.StringVar(&credentials.Username, "user", credentials.Username, "account name or email address")
+
+	_ = flags.Parse(args)
+
+	if flags.NArg() > 0 {
+		return ErrUsage
+	}
+
+	stdin := bufio.NewReader(os.Stdin)
+
+	var err error
+
+	if credentials.Username == "" {
+		credentials.Username, err = prompt(stdin, "Username: ", false)
+		if err != nil {
+			return err
+		}
+	}
+
+	if credentials.Password == "" {
+		credentials.Password, err = prompt(stdin, "Password: ", true)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Whether these are needed is only known after the password was accepted
+	for {
+		err = config.Login(ctx, credentials)
+
+		switch {
+		case errors.Is(err, drive.ErrTwoFactorTokenMissing) && credentials.TwoFA == "":
+			credentials.TwoFA, err = prompt(stdin, "Two-factor code: ", false)
+		case errors.Is(err, drive.ErrMailboxPasswordMissing) && credentials.MailboxPassword == "":
+			credentials.MailboxPassword, err = prompt(stdin, "Mailbox password: ", true)
+		default:
+			return err
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func prompt(stdin *bufio.Reader, message string, secret bool) (string, error) {
+	fmt.Fprint(os.Stderr, message)
+
+	fd := int(os.Stdin.Fd())
+
+	if secret && term.IsTerminal(fd) {
+		value, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+
+		return string(value), err
+	}
+
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
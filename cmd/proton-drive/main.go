@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+
+	drive "github.com/StollD/proton-drive"
+	"github.com/StollD/proton-drive/internal/config"
+	"github.com/henrybear327/go-proton-api"
+)
+
+const (
+	exitOK           = 0
+	exitError        = 1
+	exitUsage        = 2
+	exitNotFound     = 3
+	exitExists       = 4
+	exitInvalidType  = 5
+	exitConflict     = 6
+	exitUnauthorized = 7
+	exitDifferent    = 8
+)
+
+var (
+	ErrUsage     = errors.New("invalid arguments")
+	ErrDifferent = errors.New("local and remote folders differ")
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, config *config.Config, args []string) error
+}
+
+var commands = []*command{
+	{"login", "login [-user name]", runLogin},
+	{"ls", "ls [-l] [path]", runLs},
+	{"tree", "tree [path]", runTree},
+	{"stat", "stat <path>", runStat},
+	{"find", "find [-name pattern] [-type f|d] [path]", runFind},
+	{"du", "du [-h] [path]", runDu},
+	{"devices", "devices", runDevices},
+	{"shared", "shared", runShared},
+	{"photos", "photos", runPhotos},
+	{"get", "get <remote> [local]", runGet},
+	{"put", "put [-exclusive] [-unique] <local> <remote>", runPut},
+	{"cat", "cat <path>...", runCat},
+	{"mkdir", "mkdir [-p] <path>...", runMkdir},
+	{"mv", "mv <source> <target>", runMv},
+	{"rm", "rm [-r] <path>...", runRm},
+	{"sync", "sync [-dry-run] [-watch] [flags] <local> <remote>", runSync},
+	{"push", "push [-delay 2s] [-state file] <local> <remote>", runPush},
+	{"mirror", "mirror [-interval 5m] [-state file] <remote> <local>", runMirror},
+	{"compare", "compare [-mtime] [-tolerance 1s] <local> <remote>", runCompare},
+	{"serve", "serve webdav|s3|sftp|9p|http [flags]", runServe},
+}
+
+// Print results as JSON instead of text
+var jsonOutput bool
+
+func main() {
+	config := &config.Config{}
+
+	flags := flag.NewFlagSet("proton-drive", flag.ExitOnError)
+	config.Register(flags)
+
+	flags.BoolVar(&jsonOutput, "json", false, "print results and errors as JSON")
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: proton-drive [flags] <command> [args]\n\nCommands:\n")
+
+		for _, cmd := range commands {
+			fmt.Fprintf(flags.Output(), "  %s\n", cmd.usage)
+		}
+
+		fmt.Fprintf(flags.Output(), "\nFlags:\n")
+		flags.PrintDefaults()
+
+		fmt.Fprintf(flags.Output(), "\nExit codes:\n")
+		fmt.Fprintf(flags.Output(), "  %d  success\n", exitOK)
+		fmt.Fprintf(flags.Output(), "  %d  error\n", exitError)
+		fmt.Fprintf(flags.Output(), "  %d  invalid arguments\n", exitUsage)
+		fmt.Fprintf(flags.Output(), "  %d  file or folder not found\n", exitNotFound)
+		fmt.Fprintf(flags.Output(), "  %d  file or folder already exists\n", exitExists)
+		fmt.Fprintf(flags.Output(), "  %d  got a folder where a file was expected, or vice versa\n", exitInvalidType)
+		fmt.Fprintf(flags.Output(), "  %d  file was changed concurrently\n", exitConflict)
+		fmt.Fprintf(flags.Output(), "  %d  login required or failed\n", exitUnauthorized)
+		fmt.Fprintf(flags.Output(), "  %d  compared folders are different\n", exitDifferent)
+	}
+
+	_ = flags.Parse(os.Args[1:])
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(exitUsage)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	name := flags.Arg(0)
+
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+
+		err := cmd.run(ctx, config, flags.Args()[1:])
+		if errors.Is(err, ErrUsage) {
+			fmt.Fprintf(os.Stderr, "Usage: proton-drive %s\n", cmd.usage)
+		}
+
+		if err != nil {
+			printError(name, err)
+			os.Exit(exitCode(err))
+		}
+
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "proton-drive: unknown command %q\n", name)
+	flags.Usage()
+	os.Exit(exitUsage)
+}
+
+// exitCode maps errors from the library onto the documented exit codes.
+func exitCode(err error) int {
+	var apiErr *proton.APIError
+
+	switch {
+	case errors.Is(err, ErrUsage):
+		return exitUsage
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, drive.ErrInvalidLink):
+		return exitNotFound
+	case errors.Is(err, drive.ErrAlreadyExists), errors.Is(err, drive.ErrNoAvailableName), errors.Is(err, fs.ErrExist):
+		return exitExists
+	case errors.Is(err, drive.ErrInvalidLinkType):
+		return exitInvalidType
+	case errors.Is(err, drive.ErrRevisionConflict):
+		return exitConflict
+	case errors.Is(err, drive.ErrUsernamePasswordMissing),
+		errors.Is(err, drive.ErrTwoFactorTokenMissing),
+		errors.Is(err, drive.ErrMailboxPasswordMissing),
+		errors.Is(err, drive.ErrKeyringUnlockFailed):
+		return exitUnauthorized
+	case errors.As(err, &apiErr) && apiErr.Status == 401:
+		return exitUnauthorized
+	case errors.Is(err, ErrDifferent):
+		return exitDifferent
+	}
+
+	return exitError
+}
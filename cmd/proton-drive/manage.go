@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	pathlib "path"
+
+	drive "github.com/StollD/proton-drive"
+	"github.com/StollD/proton-drive/daemon"
+	"github.com/StollD/proton-drive/internal/config"
+)
+
+func runMkdir(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("mkdir", flag.ExitOnError)
+	parents := flags.Bool("p", false, "create missing parent folders, and don't fail if the folder exists")
+
+	_ = flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		return ErrUsage
+	}
+
+	session, err := config.OpenSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	created := []*drive.Link{}
+
+	for _, path := range flags.Args() {
+		link, err := mkdir(ctx, session, pathlib.Join("/", path), *parents)
+		if err != nil {
+			return err
+		}
+
+		created = append(created, link)
+	}
+
+	if jsonOutput {
+		return printJSON(entries(created))
+	}
+
+	return nil
+}
+
+func mkdir(ctx context.Context, session *drive.Session, path string, parents bool) (*drive.Link, error) {
+	if parents {
+		link := session.Links().LinkFromPath(path)
+
+		if link != nil && link.IsDir() {
+			return link, nil
+		}
+
+		if link == nil && path != "/" {
+			_, err := mkdir(ctx, session, pathlib.Dir(path), true)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	parent, err := lookupDir(session, pathlib.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+
+	link, err := session.FileSystem().CreateDir(ctx, parent, pathlib.Base(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return link, nil
+}
+
+// runMv moves or renames a file or folder. If the target is an existing folder, the source is moved into it.
+func runMv(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("mv", flag.ExitOnError)
+
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		return ErrUsage
+	}
+
+	session, err := config.OpenSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	link, err := lookup(session, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if link.IsRoot() {
+		return fmt.Errorf("cannot move the root folder: %w", drive.ErrInvalidLinkType)
+	}
+
+	parent, name, err := target(session, flags.Arg(1), link.Name())
+	if err != nil {
+		return err
+	}
+
+	link, err = session.FileSystem().Move(ctx, link, parent, name)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		return printJSON(entry(link))
+	}
+
+	return nil
+}
+
+// runRm moves files and folders to the trash.
+func runRm(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("rm", flag.ExitOnError)
+	recursive := flags.Bool("r", false, "remove folders and their contents")
+
+	_ = flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		return ErrUsage
+	}
+
+	session, err := config.OpenSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	removed := []*daemon.Entry{}
+
+	for _, path := range flags.Args() {
+		link, err := lookup(session, path)
+		if err != nil {
+			return err
+		}
+
+		if link.IsRoot() {
+			return fmt.Errorf("cannot remove the root folder: %w", drive.ErrInvalidLinkType)
+		}
+
+		if link.IsDir() && !*recursive && link.Children().Cardinality() > 0 {
+			return fmt.Errorf("%s: folder is not empty, use -r: %w", path, drive.ErrInvalidLinkType)
+		}
+
+		// Deleting removes the link from the tree, so it has to be described before
+		info := entry(link)
+
+		err = session.FileSystem().Delete(ctx, link)
+		if err != nil {
+			return err
+		}
+
+		removed = append(removed, info)
+	}
+
+	if jsonOutput {
+		return printJSON(removed)
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	pathlib "path"
+	"strconv"
+
+	drive "github.com/StollD/proton-drive"
+	"github.com/StollD/proton-drive/daemon"
+)
+
+func printJSON(value any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(value)
+}
+
+func printError(name string, err error) {
+	if !jsonOutput {
+		fmt.Fprintf(os.Stderr, "proton-drive %s: %v\n", name, err)
+		return
+	}
+
+	encoder := json.NewEncoder(os.Stderr)
+
+	_ = encoder.Encode(map[string]any{
+		"error": err.Error(),
+		"code":  exitCode(err),
+	})
+}
+
+func entry(link *drive.Link) *daemon.Entry {
+	return daemon.NewEntry(link)
+}
+
+func entries(links []*drive.Link) []*daemon.Entry {
+	out := make([]*daemon.Entry, len(links))
+
+	for i, link := range links {
+		out[i] = entry(link)
+	}
+
+	return out
+}
+
+// lookup resolves a remote path. Paths are always relative to the root folder.
+func lookup(session *drive.Session, path string) (*drive.Link, error) {
+	link := session.Links().LinkFromPath(pathlib.Join("/", path))
+	if link == nil {
+		return nil, fmt.Errorf("%s: %w", path, fs.ErrNotExist)
+	}
+
+	return link, nil
+}
+
+func lookupDir(session *drive.Session, path string) (*drive.Link, error) {
+	link, err := lookup(session, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !link.IsDir() {
+		return nil, fmt.Errorf("%s: not a folder: %w", path, drive.ErrInvalidLinkType)
+	}
+
+	return link, nil
+}
+
+func lookupFile(session *drive.Session, path string) (*drive.Link, error) {
+	link, err := lookup(session, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !link.IsFile() {
+		return nil, fmt.Errorf("%s: not a file: %w", path, drive.ErrInvalidLinkType)
+	}
+
+	return link, nil
+}
+
+// target resolves the destination of an operation the way cp and mv do: an existing folder receives the source
+// under its own name, anything else names the destination itself.
+func target(session *drive.Session, path string, name string) (*drive.Link, string, error) {
+	link := session.Links().LinkFromPath(pathlib.Join("/", path))
+	if link != nil && link.IsDir() {
+		return link, name, nil
+	}
+
+	path = pathlib.Join("/", path)
+
+	parent, err := lookupDir(session, pathlib.Dir(path))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return parent, pathlib.Base(path), nil
+}
+
+func formatSize(size int64, human bool) string {
+	const unit = 1024
+
+	if !human || size < unit {
+		return strconv.FormatInt(size, 10)
+	}
+
+	value := float64(size)
+	suffixes := []string{"K", "M", "G", "T"}
+
+	for i := range suffixes {
+		value /= unit
+
+		if value < unit || i == len(suffixes)-1 {
+			return strconv.FormatFloat(value, 'f', 1, 64) + suffixes[i]
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/StollD/proton-drive/fileserver"
+	"github.com/StollD/proton-drive/internal/config"
+	"github.com/StollD/proton-drive/internal/httpauth"
+	"github.com/StollD/proton-drive/ninep"
+	"github.com/StollD/proton-drive/s3"
+	"github.com/StollD/proton-drive/sftp"
+	"github.com/StollD/proton-drive/webdav"
+)
+
+var (
+	ErrUnknownProtocol = errors.New("unknown protocol")
+	ErrNoCredentials   = errors.New("no credentials configured")
+)
+
+func runServe(ctx context.Context, config *config.Config, args []string) error {
+	if len(args) == 0 {
+		return ErrUnknownProtocol
+	}
+
+	switch args[0] {
+	case "webdav":
+		return serveWebDAV(ctx, config, args[1:])
+	case "s3":
+		return serveS3(ctx, config, args[1:])
+	case "sftp":
+		return serveSFTP(ctx, config, args[1:])
+	case "9p":
+		return serve9P(ctx, config, args[1:])
+	case "http":
+		return serveHTTP(ctx, config, args[1:])
+	}
+
+	return fmt.Errorf("%w: %s", ErrUnknownProtocol, args[0])
+}
+
+func serveWebDAV(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("serve webdav", flag.ExitOnError)
+
+	addr := flags.String("addr", "127.0.0.1:8080", "address to listen on")
+	user := flags.String("user", "", "username for basic authentication")
+	pass := flags.String("pass", os.Getenv("PROTON_DRIVE_WEBDAV_PASSWORD"), "password for basic authentication")
+
+	_ = flags.Parse(args)
+
+	session, err := config.OpenSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	return listenAndServe(ctx, *addr, webdav.NewHandler(session, *user, *pass))
+}
+
+func serveS3(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("serve s3", flag.ExitOnError)
+
+	addr := flags.String("addr", "127.0.0.1:9000", "address to listen on")
+	accessKey := flags.String("access-key", "", "access key id that clients authenticate with")
+	secretKey := flags.String("secret-key", os.Getenv("PROTON_DRIVE_S3_SECRET_KEY"), "secret key for the access key id")
+	keysFile := flags.String("keys", "", "file with one \"<access key id> <secret key>\" pair per line")
+	spoolDir := flags.String("spool", os.TempDir(), "directory for storing parts of multipart uploads")
+
+	_ = flags.Parse(args)
+
+	credentials := map[string]string{}
+
+	if *accessKey != "" {
+		credentials[*accessKey] = *secretKey
+	}
+
+	if *keysFile != "" {
+		data, err := os.ReadFile(*keysFile)
+		if err != nil {
+			return err
+		}
+
+		for _, line := range strings.Split(string(data), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) != 2 || strings.HasPrefix(fields[0], "#") {
+				continue
+			}
+
+			credentials[fields[0]] = fields[1]
+		}
+	}
+
+	if len(credentials) == 0 {
+		return ErrNoCredentials
+	}
+
+	session, err := config.OpenSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	handler := s3.NewHandler(session, credentials)
+	handler.SetSpoolDir(*spoolDir)
+
+	defer func() {
+		_ = handler.Close()
+	}()
+
+	return listenAndServe(ctx, *addr, handler)
+}
+
+func serveSFTP(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("serve sftp", flag.ExitOnError)
+
+	addr := flags.String("addr", "127.0.0.1:2022", "address to listen on")
+	hostKey := flags.String("host-key", filepath.Join(config.Dir, "ssh_host_ed25519_key"), "SSH host key")
+	authorizedKeys := flags.String(
+		"authorized-keys",
+		filepath.Join(config.Dir, "authorized_keys"),
+		"allowed public keys",
+	)
+
+	_ = flags.Parse(args)
+
+	session, err := config.OpenSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	server, err := sftp.NewServer(session, *hostKey, *authorizedKeys)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+
+	return server.Serve(ctx, listener)
+}
+
+func serve9P(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("serve 9p", flag.ExitOnError)
+
+	addr := flags.String("addr", "127.0.0.1:5640", "TCP address to listen on")
+	socket := flags.String("unix", "", "unix socket to listen on instead of TCP")
+	uid := flags.Uint("uid", uint(os.Getuid()), "user id that files are owned by")
+	gid := flags.Uint("gid", uint(os.Getgid()), "group id that files are owned by")
+
+	_ = flags.Parse(args)
+
+	session, err := config.OpenSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	server := ninep.NewServer(session)
+	server.SetOwner(uint32(*uid), uint32(*gid))
+
+	network, address := "tcp", *addr
+	if *socket != "" {
+		network, address = "unix", *socket
+
+		// Remove a stale socket from a previous run
+		_ = os.Remove(*socket)
+	}
+
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+
+	if *socket != "" {
+		defer func() {
+			_ = os.Remove(*socket)
+		}()
+
+		// The socket grants full access to the drive, so only the owner may connect
+		err = os.Chmod(*socket, 0600)
+		if err != nil {
+			_ = listener.Close()
+			return err
+		}
+	}
+
+	return server.Serve(ctx, listener)
+}
+
+func serveHTTP(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("serve http", flag.ExitOnError)
+
+	addr := flags.String("addr", "127.0.0.1:8081", "address to listen on")
+	user := flags.String("user", "", "username for basic authentication")
+	pass := flags.String("pass", os.Getenv("PROTON_DRIVE_HTTP_PASSWORD"), "password for basic authentication")
+
+	_ = flags.Parse(args)
+
+	session, err := config.OpenSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	var handler http.Handler = fileserver.NewHandler(session)
+
+	if *user != "" {
+		handler = httpauth.Basic(handler, *user, *pass)
+	}
+
+	return listenAndServe(ctx, *addr, handler)
+}
+
+func listenAndServe(ctx context.Context, addr string, handler http.Handler) error {
+	server := &http.Server{Addr: addr, Handler: handler}
+
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+
+	err := server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/StollD/proton-drive/foldersync"
+	"github.com/StollD/proton-drive/internal/config"
+)
+
+// runSync keeps a local folder in sync with a remote folder, once or continuously with -watch.
+func runSync(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("sync", flag.ExitOnError)
+
+	dryRun := flags.Bool("dry-run", false, "print the planned actions without changing anything")
+	watch := flags.Bool("watch", false, "keep running and sync whenever something changes")
+	interval := flags.Duration("interval", time.Minute, "how often to scan the local folder for changes with -watch")
+	statePath := flags.String("state", "", "file for the sync state, stored in the local folder by default")
+
+	maxDeletes := flags.Int("max-deletes", foldersync.DefaultMaxDeletes, "refuse to delete more files, 0 disables it")
+	maxPercent := flags.Int(
+		"max-delete-percent",
+		foldersync.DefaultMaxDeletePercent,
+		"refuse to delete a larger percentage of the files, 0 disables it",
+	)
+
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 2 || (*dryRun && *watch) {
+		return ErrUsage
+	}
+
+	session, err := config.OpenSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	engine := foldersync.NewEngine(session, flags.Arg(0), flags.Arg(1))
+	engine.SetDeleteLimits(*maxDeletes, *maxPercent)
+
+	if *statePath != "" {
+		engine.SetStatePath(*statePath)
+	}
+
+	if *watch {
+		return engine.Run(ctx, *interval, func(plan *foldersync.Plan, err error) {
+			if plan != nil {
+				_ = printPlan(plan)
+			}
+
+			if err != nil {
+				printError("sync", err)
+			}
+		})
+	}
+
+	if *dryRun {
+		plan, err := engine.Plan(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = printPlan(plan)
+		if err != nil {
+			return err
+		}
+
+		return engine.CheckLimits(plan)
+	}
+
+	plan, err := engine.Sync(ctx)
+	if plan != nil {
+		printErr := printPlan(plan)
+		if err == nil {
+			err = printErr
+		}
+	}
+
+	return err
+}
+
+// runPush uploads changes to a local folder as they happen, until it is interrupted.
+func runPush(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("push", flag.ExitOnError)
+
+	delay := flags.Duration("delay", foldersync.DefaultPushDelay, "how long a file has to be unchanged to be uploaded")
+	statePath := flags.String("state", "", "file for the push state, stored in the local folder by default")
+
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 2 || *delay <= 0 {
+		return ErrUsage
+	}
+
+	session, err := config.OpenSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	pusher := foldersync.NewPusher(session, flags.Arg(0), flags.Arg(1))
+	pusher.SetDelay(*delay)
+
+	if *statePath != "" {
+		pusher.SetStatePath(*statePath)
+	}
+
+	return pusher.Run(ctx, printAction)
+}
+
+// runMirror keeps a read-only local copy of a remote folder, until it is interrupted.
+func runMirror(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("mirror", flag.ExitOnError)
+
+	interval := flags.Duration("interval", 5*time.Minute, "how often to compare the whole folder, to retry failures")
+	statePath := flags.String("state", "", "file for the mirror state, stored in the local folder by default")
+
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 2 || *interval <= 0 {
+		return ErrUsage
+	}
+
+	session, err := config.OpenSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	mirror := foldersync.NewMirror(session, flags.Arg(0), flags.Arg(1))
+
+	if *statePath != "" {
+		mirror.SetStatePath(*statePath)
+	}
+
+	return mirror.Run(ctx, *interval, printAction)
+}
+
+// runCompare reports the differences between a local folder and a remote folder. It fails with ErrDifferent if
+// there are any, so scripts can check the exit code.
+func runCompare(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("compare", flag.ExitOnError)
+
+	modTime := flags.Bool("mtime", false, "report files whose modification times differ")
+	tolerance := flags.Duration("tolerance", time.Second, "how far modification times may differ with -mtime")
+
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		return ErrUsage
+	}
+
+	session, err := config.OpenSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	report, err := foldersync.Compare(ctx, session, flags.Arg(0), flags.Arg(1), foldersync.CompareOptions{
+		ModTime:          *modTime,
+		ModTimeTolerance: *tolerance,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		err = printJSON(report)
+	} else {
+		for _, difference := range report.Differences {
+			fmt.Fprintln(os.Stdout, difference)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if len(report.Differences) > 0 {
+		return fmt.Errorf(
+			"%w: %d differences in %d files and %d folders",
+			ErrDifferent, len(report.Differences), report.Files, report.Folders,
+		)
+	}
+
+	return nil
+}
+
+func printAction(action *foldersync.Action) {
+	if jsonOutput {
+		_ = printJSON(action)
+	} else {
+		fmt.Fprintln(os.Stdout, action)
+	}
+}
+
+func printPlan(plan *foldersync.Plan) error {
+	if jsonOutput {
+		return printJSON(plan)
+	}
+
+	for _, action := range plan.Actions {
+		fmt.Fprintln(os.Stdout, action)
+	}
+
+	return nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	drive "github.com/StollD/proton-drive"
+	"github.com/StollD/proton-drive/internal/config"
+)
+
+// runGet downloads a file. The local path defaults to the name of the file in the current directory.
+func runGet(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("get", flag.ExitOnError)
+
+	_ = flags.Parse(args)
+
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		return ErrUsage
+	}
+
+	session, err := config.OpenSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	link, err := lookupFile(session, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	local := link.Name()
+
+	if flags.NArg() == 2 {
+		local = flags.Arg(1)
+
+		info, err := os.Stat(local)
+		if err == nil && info.IsDir() {
+			local = filepath.Join(local, link.Name())
+		}
+	}
+
+	err = download(ctx, session, link, local)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		return printJSON(entry(link))
+	}
+
+	return nil
+}
+
+// download writes the file to a temporary file next to the local path first, so an interrupted download doesn't
+// leave a truncated file behind.
+func download(ctx context.Context, session *drive.Session, link *drive.Link, local string) error {
+	reader, err := session.FileSystem().Download(ctx, link)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	file, err := os.CreateTemp(filepath.Dir(local), "."+filepath.Base(local)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = os.Remove(file.Name())
+	}()
+
+	// Temporary files are only accessible by their owner
+	err = file.Chmod(0644)
+	if err == nil {
+		_, err = io.Copy(file, reader)
+	}
+
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = os.Chtimes(file.Name(), link.ModificationTime(), link.ModificationTime())
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), local)
+}
+
+// runPut uploads a file. If the remote path is a folder the file keeps its name, otherwise the remote path is
+// the path of the uploaded file.
+func runPut(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("put", flag.ExitOnError)
+	exclusive := flags.Bool("exclusive", false, "fail if the file already exists instead of adding a revision")
+	unique := flags.Bool("unique", false, "pick a free name like \"name (1).ext\" if the file already exists")
+
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		return ErrUsage
+	}
+
+	local := flags.Arg(0)
+
+	file, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		return fmt.Errorf("%s: not a file: %w", local, drive.ErrInvalidLinkType)
+	}
+
+	session, err := config.OpenSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	parent, name, err := target(session, flags.Arg(1), filepath.Base(local))
+	if err != nil {
+		return err
+	}
+
+	opts := []drive.Option{}
+
+	if *exclusive {
+		opts = append(opts, drive.WithCreateMode(drive.CreateExclusive))
+	}
+
+	if *unique {
+		opts = append(opts, drive.WithNamingPolicy(drive.NamingUnique))
+	}
+
+	writer, err := session.FileSystem().Upload(ctx, parent, name, opts...)
+	if err != nil {
+		return err
+	}
+
+	writer.SetModTime(info.ModTime())
+
+	_, err = writer.ReadFrom(file)
+	if err != nil {
+		return err
+	}
+
+	link, err := writer.Commit()
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		return printJSON(entry(link))
+	}
+
+	return nil
+}
+
+// runCat writes the contents of files to stdout.
+func runCat(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("cat", flag.ExitOnError)
+
+	_ = flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		return ErrUsage
+	}
+
+	session, err := config.OpenSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Check all paths first, so nothing is printed if one of them is wrong
+	links := []*drive.Link{}
+
+	for _, path := range flags.Args() {
+		link, err := lookupFile(session, path)
+		if err != nil {
+			return err
+		}
+
+		links = append(links, link)
+	}
+
+	for _, link := range links {
+		reader, err := session.FileSystem().Download(ctx, link)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(os.Stdout, reader)
+		_ = reader.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
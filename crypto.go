@@ -114,13 +114,17 @@ func getKeyRing(kr, addrKR *crypto.KeyRing, key, passphrase, passphraseSignature
 		return nil, err
 	}
 
-	sig, err := crypto.NewPGPSignatureFromArmored(passphraseSignature)
-	if err != nil {
-		return nil, err
-	}
-
-	if err := addrKR.VerifyDetached(dec, sig, crypto.GetUnixTime()); err != nil {
-		return nil, err
+	// Links whose signatures can't be verified are loaded without a keyring, if the signature policy allows it
+	if addrKR != nil {
+		sig, err := crypto.NewPGPSignatureFromArmored(passphraseSignature)
+		if err != nil {
+			return nil, err
+		}
+
+		err = addrKR.VerifyDetached(dec, sig, crypto.GetUnixTime())
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	lockedKey, err := crypto.NewKeyFromArmored(key)
@@ -0,0 +1,304 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrUnexpectedResponse = errors.New("unexpected response")
+)
+
+// Client talks to a drived server. Every call uses its own connection, so a client can be shared between
+// goroutines.
+type Client struct {
+	//
+	// PARAMETERS
+	//
+
+	socket string
+
+	//
+	// INTERNAL STATE
+	//
+
+	nextID atomic.Uint64
+}
+
+func NewClient(socket string) *Client {
+	return &Client{socket: socket}
+}
+
+// UploadOptions control how Upload creates the file.
+type UploadOptions struct {
+	// Fail instead of adding a new revision if the file exists
+	Exclusive bool
+
+	// Detected from the name and contents if empty
+	MIMEType string
+
+	// The current time if zero
+	Modified time.Time
+}
+
+type clientConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	stop   func() bool
+}
+
+func (self *clientConn) Close() error {
+	self.stop()
+	return self.conn.Close()
+}
+
+func (self *Client) dial(ctx context.Context) (*clientConn, error) {
+	dialer := &net.Dialer{}
+
+	conn, err := dialer.DialContext(ctx, "unix", self.socket)
+	if err != nil {
+		return nil, err
+	}
+
+	// Canceling the context aborts any pending read or write
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+
+	return &clientConn{conn: conn, reader: bufio.NewReader(conn), stop: stop}, nil
+}
+
+func (self *Client) send(conn *clientConn, method string, params any) (uint64, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return 0, err
+	}
+
+	req := &request{
+		Version: protocolVersion,
+		ID:      self.nextID.Add(1),
+		Method:  method,
+		Params:  data,
+	}
+
+	return req.ID, writeMessage(conn.conn, req)
+}
+
+func (self *Client) receive(conn *clientConn, id uint64, result any) error {
+	rsp := &response{}
+
+	err := readMessage(conn.reader, rsp)
+	if err != nil {
+		return err
+	}
+
+	if rsp.ID != id {
+		return ErrUnexpectedResponse
+	}
+
+	if rsp.Error != nil {
+		return rsp.Error
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(rsp.Result, result)
+}
+
+func (self *Client) call(ctx context.Context, method string, params any, result any) error {
+	conn, err := self.dial(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	id, err := self.send(conn, method, params)
+	if err != nil {
+		return err
+	}
+
+	return self.receive(conn, id, result)
+}
+
+func (self *Client) Stat(ctx context.Context, path string) (*Entry, error) {
+	out := &Entry{}
+	return out, self.call(ctx, MethodStat, &pathParams{Path: path}, out)
+}
+
+// List returns the children of a folder.
+func (self *Client) List(ctx context.Context, path string) ([]*Entry, error) {
+	out := []*Entry{}
+	return out, self.call(ctx, MethodList, &pathParams{Path: path}, &out)
+}
+
+// Walk returns all links below a folder, sorted by path.
+func (self *Client) Walk(ctx context.Context, path string) ([]*Entry, error) {
+	out := []*Entry{}
+	return out, self.call(ctx, MethodWalk, &pathParams{Path: path}, &out)
+}
+
+func (self *Client) Mkdir(ctx context.Context, path string) (*Entry, error) {
+	out := &Entry{}
+	return out, self.call(ctx, MethodMkdir, &pathParams{Path: path}, out)
+}
+
+// Move moves or renames a link. The target is the full path that the link will have afterwards.
+func (self *Client) Move(ctx context.Context, path string, target string) (*Entry, error) {
+	out := &Entry{}
+	return out, self.call(ctx, MethodMove, &moveParams{Path: path, Target: target}, out)
+}
+
+func (self *Client) Delete(ctx context.Context, path string) error {
+	return self.call(ctx, MethodDelete, &pathParams{Path: path}, nil)
+}
+
+// Upload streams the contents of a reader into a file, creating it or adding a new revision.
+func (self *Client) Upload(
+	ctx context.Context, path string, reader io.Reader, options UploadOptions,
+) (*Entry, error) {
+	conn, err := self.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	id, err := self.send(conn, MethodUpload, &uploadParams{
+		Path:      path,
+		Exclusive: options.Exclusive,
+		MIMEType:  options.MIMEType,
+		Modified:  options.Modified,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	writer := &frameWriter{writer: conn.conn}
+
+	_, err = io.Copy(writer, reader)
+	if err == nil {
+		err = writer.Close()
+	}
+
+	out := &Entry{}
+
+	// The server replies early if it can't accept the upload, which is more useful than the write error
+	rspErr := self.receive(conn, id, out)
+	if rspErr != nil {
+		return nil, rspErr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// Download opens a file for reading. The returned reader must be closed.
+func (self *Client) Download(ctx context.Context, path string) (io.ReadCloser, *Entry, error) {
+	conn, err := self.dial(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	id, err := self.send(conn, MethodDownload, &pathParams{Path: path})
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+
+	out := &Entry{}
+
+	err = self.receive(conn, id, out)
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+
+	return &downloadReader{frames: &frameReader{reader: conn.reader}, conn: conn}, out, nil
+}
+
+type downloadReader struct {
+	frames *frameReader
+	conn   *clientConn
+}
+
+func (self *downloadReader) Read(buffer []byte) (int, error) {
+	return self.frames.Read(buffer)
+}
+
+func (self *downloadReader) Close() error {
+	return self.conn.Close()
+}
+
+// Subscribe streams changes below a path. The channel is closed when the context is canceled or the connection is
+// lost. Subscribers that can't keep up are disconnected too, so after the channel is closed unexpectedly, clients
+// should rescan the tree before subscribing again.
+func (self *Client) Subscribe(ctx context.Context, path string) (<-chan Change, error) {
+	conn, err := self.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := self.send(conn, MethodSubscribe, &pathParams{Path: path})
+	if err == nil {
+		err = self.receive(conn, id, nil)
+	}
+
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	changes := make(chan Change)
+
+	go func() {
+		defer close(changes)
+
+		defer func() {
+			_ = conn.Close()
+		}()
+
+		for {
+			msg := &response{}
+
+			err := readMessage(conn.reader, msg)
+			if err != nil {
+				return
+			}
+
+			if msg.Method != notificationChange {
+				continue
+			}
+
+			change := Change{}
+
+			err = json.Unmarshal(msg.Params, &change)
+			if err != nil {
+				return
+			}
+
+			select {
+			case changes <- change:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return changes, nil
+}
@@ -0,0 +1,298 @@
+package daemon
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"time"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+// The protocol is JSON-RPC 2.0 with one message per line. Uploads and downloads send the file contents right after
+// the request or response as length prefixed frames, terminated by an empty frame. Subscriptions turn the connection
+// into a stream of notifications.
+
+const (
+	protocolVersion = "2.0"
+	frameSize       = 64 << 10
+)
+
+const (
+	MethodStat      = "stat"
+	MethodList      = "list"
+	MethodWalk      = "walk"
+	MethodMkdir     = "mkdir"
+	MethodMove      = "move"
+	MethodDelete    = "delete"
+	MethodUpload    = "upload"
+	MethodDownload  = "download"
+	MethodSubscribe = "subscribe"
+
+	notificationChange = "change"
+)
+
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+
+	CodeNotFound         = 1
+	CodeAlreadyExists    = 2
+	CodeInvalidType      = 3
+	CodeRevisionConflict = 4
+	CodeNoAvailableName  = 5
+)
+
+// Error is an error returned by the daemon. It unwraps to the matching library error, so callers can use errors.Is
+// with fs.ErrNotExist and the drive errors.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (self *Error) Error() string {
+	return self.Message
+}
+
+func (self *Error) Unwrap() error {
+	switch self.Code {
+	case CodeNotFound:
+		return fs.ErrNotExist
+	case CodeAlreadyExists:
+		return drive.ErrAlreadyExists
+	case CodeInvalidType:
+		return drive.ErrInvalidLinkType
+	case CodeRevisionConflict:
+		return drive.ErrRevisionConflict
+	case CodeNoAvailableName:
+		return drive.ErrNoAvailableName
+	}
+
+	return nil
+}
+
+func toError(err error) *Error {
+	var out *Error
+
+	switch {
+	case errors.As(err, &out):
+		return out
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, drive.ErrInvalidLink):
+		return &Error{Code: CodeNotFound, Message: err.Error()}
+	case errors.Is(err, drive.ErrAlreadyExists):
+		return &Error{Code: CodeAlreadyExists, Message: err.Error()}
+	case errors.Is(err, drive.ErrInvalidLinkType):
+		return &Error{Code: CodeInvalidType, Message: err.Error()}
+	case errors.Is(err, drive.ErrRevisionConflict):
+		return &Error{Code: CodeRevisionConflict, Message: err.Error()}
+	case errors.Is(err, drive.ErrNoAvailableName):
+		return &Error{Code: CodeNoAvailableName, Message: err.Error()}
+	}
+
+	return &Error{Code: CodeInternalError, Message: err.Error()}
+}
+
+type request struct {
+	Version string          `json:"jsonrpc"`
+	ID      uint64          `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	Version string          `json:"jsonrpc"`
+	ID      uint64          `json:"id"`
+	Method  string          `json:"method,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+type notification struct {
+	Version string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+// Entry describes a link.
+type Entry struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Path       string    `json:"path"`
+	Type       string    `json:"type"`
+	Size       int64     `json:"size"`
+	MIMEType   string    `json:"mime_type,omitempty"`
+	RevisionID string    `json:"revision_id,omitempty"`
+	Hash       string    `json:"hash,omitempty"`
+	Created    time.Time `json:"created"`
+	Modified   time.Time `json:"modified"`
+}
+
+func (self *Entry) IsDir() bool {
+	return self.Type == "dir"
+}
+
+// NewEntry describes a link the same way the daemon does, for tools that print links as JSON.
+func NewEntry(link *drive.Link) *Entry {
+	entry := &Entry{
+		ID:       link.ID(),
+		Name:     link.Name(),
+		Path:     link.Path(),
+		Type:     "file",
+		Created:  link.CreationTime(),
+		Modified: link.ModificationTime(),
+	}
+
+	if link.IsDir() {
+		entry.Type = "dir"
+	} else {
+		entry.Size = link.Size()
+		entry.MIMEType = link.MIMEType()
+		entry.RevisionID = link.RevisionID()
+		entry.Hash = link.ContentHash()
+	}
+
+	return entry
+}
+
+// Change is a notification about a modification of the link tree.
+type Change struct {
+	Type    string `json:"type"`
+	ID      string `json:"id"`
+	Path    string `json:"path"`
+	OldPath string `json:"old_path,omitempty"`
+}
+
+func newChange(change drive.Change) Change {
+	out := Change{ID: change.LinkID, Path: change.Path, OldPath: change.OldPath}
+
+	switch change.Type {
+	case drive.ChangeCreate:
+		out.Type = "create"
+	case drive.ChangeUpdate:
+		out.Type = "update"
+	case drive.ChangeDelete:
+		out.Type = "delete"
+	}
+
+	return out
+}
+
+type pathParams struct {
+	Path string `json:"path"`
+}
+
+type moveParams struct {
+	Path   string `json:"path"`
+	Target string `json:"target"`
+}
+
+type uploadParams struct {
+	Path      string    `json:"path"`
+	Exclusive bool      `json:"exclusive,omitempty"`
+	MIMEType  string    `json:"mime_type,omitempty"`
+	Modified  time.Time `json:"modified"`
+}
+
+func readMessage(reader *bufio.Reader, out any) error {
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(line, out)
+}
+
+func writeMessage(writer io.Writer, message any) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(append(data, '\n'))
+	return err
+}
+
+// frameWriter splits a stream into frames. Close writes the terminating empty frame.
+type frameWriter struct {
+	writer io.Writer
+}
+
+func (self *frameWriter) Write(buffer []byte) (int, error) {
+	written := 0
+
+	for len(buffer) > 0 {
+		size := min(len(buffer), frameSize)
+
+		header := binary.BigEndian.AppendUint32(nil, uint32(size))
+
+		_, err := self.writer.Write(append(header, buffer[:size]...))
+		if err != nil {
+			return written, err
+		}
+
+		written += size
+		buffer = buffer[size:]
+	}
+
+	return written, nil
+}
+
+func (self *frameWriter) Close() error {
+	_, err := self.writer.Write(binary.BigEndian.AppendUint32(nil, 0))
+	return err
+}
+
+// frameReader joins frames back into a stream, and returns io.EOF at the terminating frame.
+type frameReader struct {
+	reader *bufio.Reader
+
+	remaining uint32
+	done      bool
+}
+
+func (self *frameReader) Read(buffer []byte) (int, error) {
+	if self.done {
+		return 0, io.EOF
+	}
+
+	if self.remaining == 0 {
+		header := make([]byte, 4)
+
+		_, err := io.ReadFull(self.reader, header)
+		if err != nil {
+			return 0, unexpectedEOF(err)
+		}
+
+		self.remaining = binary.BigEndian.Uint32(header)
+
+		if self.remaining == 0 {
+			self.done = true
+			return 0, io.EOF
+		}
+	}
+
+	if uint32(len(buffer)) > self.remaining {
+		buffer = buffer[:self.remaining]
+	}
+
+	n, err := self.reader.Read(buffer)
+	self.remaining -= uint32(n)
+
+	return n, unexpectedEOF(err)
+}
+
+// A stream may only end at the terminating frame
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
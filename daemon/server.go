@@ -0,0 +1,469 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	pathlib "path"
+	"sort"
+	"strings"
+	"sync"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+const (
+	// Subscribers that fall this far behind are disconnected instead of blocking updates of the tree
+	subscriberBuffer = 1024
+)
+
+// Server exposes the link tree and file system of a session to other processes.
+type Server struct {
+	//
+	// PARAMETERS
+	//
+
+	session *drive.Session
+
+	//
+	// INTERNAL STATE
+	//
+
+	subscribers map[*subscriber]struct{}
+	lock        sync.Mutex
+}
+
+type subscriber struct {
+	path    string
+	changes chan Change
+}
+
+func NewServer(session *drive.Session) *Server {
+	self := &Server{
+		session:     session,
+		subscribers: map[*subscriber]struct{}{},
+	}
+
+	session.Links().OnChange(self.broadcast)
+
+	return self
+}
+
+// Serve accepts connections on the listener until the context is canceled.
+func (self *Server) Serve(ctx context.Context, listener net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		go self.handle(ctx, conn)
+	}
+}
+
+func (self *Server) handle(ctx context.Context, conn net.Conn) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	defer cancel()
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+
+	for {
+		req := &request{}
+
+		err := readMessage(reader, req)
+		if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+			return
+		}
+
+		if err != nil {
+			_ = self.reply(conn, req.ID, nil, &Error{Code: CodeParseError, Message: err.Error()})
+			return
+		}
+
+		switch req.Method {
+		case MethodUpload:
+			err = self.upload(ctx, conn, reader, req)
+		case MethodDownload:
+			err = self.download(ctx, conn, req)
+		case MethodSubscribe:
+			err = self.subscribe(ctx, conn, reader, req)
+		default:
+			var result any
+
+			result, err = self.call(ctx, req)
+			if err != nil {
+				err = self.reply(conn, req.ID, nil, toError(err))
+			} else {
+				err = self.reply(conn, req.ID, result, nil)
+			}
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (self *Server) reply(conn net.Conn, id uint64, result any, rpcErr *Error) error {
+	rsp := &response{Version: protocolVersion, ID: id, Error: rpcErr}
+
+	if rpcErr == nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+
+		rsp.Result = data
+	}
+
+	return writeMessage(conn, rsp)
+}
+
+func (self *Server) call(ctx context.Context, req *request) (any, error) {
+	files := self.session.FileSystem()
+
+	switch req.Method {
+	case MethodStat:
+		link, err := self.link(req)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewEntry(link), nil
+	case MethodList:
+		link, err := self.dir(req)
+		if err != nil {
+			return nil, err
+		}
+
+		return entries(link.Children().ToSlice()), nil
+	case MethodWalk:
+		link, err := self.dir(req)
+		if err != nil {
+			return nil, err
+		}
+
+		links := []*drive.Link{}
+		walk(link, &links)
+
+		return entries(links), nil
+	case MethodMkdir:
+		params := &pathParams{}
+
+		parent, name, err := self.parent(req, params, &params.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		link, err := files.CreateDir(ctx, parent, name)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewEntry(link), nil
+	case MethodMove:
+		params := &moveParams{}
+
+		parent, name, err := self.parent(req, params, &params.Target)
+		if err != nil {
+			return nil, err
+		}
+
+		link := self.session.Links().LinkFromPath(pathlib.Join("/", params.Path))
+		if link == nil || link.IsRoot() {
+			return nil, fs.ErrNotExist
+		}
+
+		link, err = files.Move(ctx, link, parent, name)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewEntry(link), nil
+	case MethodDelete:
+		link, err := self.link(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if link.IsRoot() {
+			return nil, drive.ErrInvalidLinkType
+		}
+
+		return struct{}{}, files.Delete(ctx, link)
+	}
+
+	return nil, &Error{Code: CodeMethodNotFound, Message: "method not found: " + req.Method}
+}
+
+func (self *Server) link(req *request) (*drive.Link, error) {
+	params := &pathParams{}
+
+	err := json.Unmarshal(req.Params, params)
+	if err != nil {
+		return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+	}
+
+	link := self.session.Links().LinkFromPath(pathlib.Join("/", params.Path))
+	if link == nil {
+		return nil, fs.ErrNotExist
+	}
+
+	return link, nil
+}
+
+func (self *Server) dir(req *request) (*drive.Link, error) {
+	link, err := self.link(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if !link.IsDir() {
+		return nil, drive.ErrInvalidLinkType
+	}
+
+	return link, nil
+}
+
+// parent decodes the params of a request and looks up the parent folder of the path that they contain.
+func (self *Server) parent(req *request, params any, path *string) (*drive.Link, string, error) {
+	err := json.Unmarshal(req.Params, params)
+	if err != nil {
+		return nil, "", &Error{Code: CodeInvalidParams, Message: err.Error()}
+	}
+
+	clean := pathlib.Join("/", *path)
+	if clean == "/" {
+		return nil, "", drive.ErrInvalidLinkType
+	}
+
+	parent := self.session.Links().LinkFromPath(pathlib.Dir(clean))
+	if parent == nil {
+		return nil, "", fs.ErrNotExist
+	}
+
+	if !parent.IsDir() {
+		return nil, "", drive.ErrInvalidLinkType
+	}
+
+	return parent, pathlib.Base(clean), nil
+}
+
+func walk(link *drive.Link, out *[]*drive.Link) {
+	for child := range link.Children().Iter() {
+		*out = append(*out, child)
+
+		if child.IsDir() {
+			walk(child, out)
+		}
+	}
+}
+
+func entries(links []*drive.Link) []*Entry {
+	out := make([]*Entry, len(links))
+
+	for i, link := range links {
+		out[i] = NewEntry(link)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Path < out[j].Path
+	})
+
+	return out
+}
+
+// upload reads the file contents that follow the request and replies once the file has been committed. If the
+// upload fails the rest of the stream can't be skipped reliably, so the connection is closed after the reply.
+func (self *Server) upload(ctx context.Context, conn net.Conn, reader *bufio.Reader, req *request) error {
+	params := &uploadParams{}
+
+	parent, name, err := self.parent(req, params, &params.Path)
+	if err != nil {
+		_ = self.reply(conn, req.ID, nil, toError(err))
+		return err
+	}
+
+	opts := []drive.Option{}
+
+	if params.Exclusive {
+		opts = append(opts, drive.WithCreateMode(drive.CreateExclusive))
+	}
+
+	if params.MIMEType != "" {
+		opts = append(opts, drive.WithMIMEType(params.MIMEType))
+	}
+
+	writer, err := self.session.FileSystem().Upload(ctx, parent, name, opts...)
+	if err != nil {
+		_ = self.reply(conn, req.ID, nil, toError(err))
+		return err
+	}
+
+	if !params.Modified.IsZero() {
+		writer.SetModTime(params.Modified)
+	}
+
+	_, err = writer.ReadFrom(&frameReader{reader: reader})
+	if err != nil {
+		_ = writer.Abort()
+		_ = self.reply(conn, req.ID, nil, toError(err))
+		return err
+	}
+
+	link, err := writer.Commit()
+	if err != nil {
+		return self.reply(conn, req.ID, nil, toError(err))
+	}
+
+	return self.reply(conn, req.ID, NewEntry(link), nil)
+}
+
+// download replies with the entry of the file, followed by its contents.
+func (self *Server) download(ctx context.Context, conn net.Conn, req *request) error {
+	link, err := self.link(req)
+	if err == nil && !link.IsFile() {
+		err = drive.ErrInvalidLinkType
+	}
+
+	if err != nil {
+		return self.reply(conn, req.ID, nil, toError(err))
+	}
+
+	reader, err := self.session.FileSystem().Download(ctx, link)
+	if err != nil {
+		return self.reply(conn, req.ID, nil, toError(err))
+	}
+
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	err = self.reply(conn, req.ID, NewEntry(link), nil)
+	if err != nil {
+		return err
+	}
+
+	// Failing halfway through closes the connection, which the client sees as a truncated stream
+	writer := &frameWriter{writer: conn}
+
+	_, err = io.Copy(writer, reader)
+	if err != nil {
+		return err
+	}
+
+	return writer.Close()
+}
+
+// subscribe streams changes below a path to the client until it disconnects.
+func (self *Server) subscribe(ctx context.Context, conn net.Conn, reader *bufio.Reader, req *request) error {
+	params := &pathParams{}
+
+	err := json.Unmarshal(req.Params, params)
+	if err != nil {
+		return self.reply(conn, req.ID, nil, &Error{Code: CodeInvalidParams, Message: err.Error()})
+	}
+
+	sub := &subscriber{
+		path:    pathlib.Join("/", params.Path),
+		changes: make(chan Change, subscriberBuffer),
+	}
+
+	self.lock.Lock()
+	self.subscribers[sub] = struct{}{}
+	self.lock.Unlock()
+
+	defer self.unsubscribe(sub)
+
+	err = self.reply(conn, req.ID, struct{}{}, nil)
+	if err != nil {
+		return err
+	}
+
+	// The client doesn't send anything else, so reading only returns once it disconnects
+	closed := make(chan struct{})
+
+	go func() {
+		_, _ = reader.ReadByte()
+		close(closed)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-closed:
+			return io.EOF
+		case change, ok := <-sub.changes:
+			if !ok {
+				return io.EOF
+			}
+
+			err := writeMessage(conn, &notification{
+				Version: protocolVersion,
+				Method:  notificationChange,
+				Params:  change,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (self *Server) unsubscribe(sub *subscriber) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if _, ok := self.subscribers[sub]; ok {
+		delete(self.subscribers, sub)
+		close(sub.changes)
+	}
+}
+
+func (self *Server) broadcast(change drive.Change) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	out := newChange(change)
+
+	for sub := range self.subscribers {
+		if !isBelow(out.Path, sub.path) && (out.OldPath == "" || !isBelow(out.OldPath, sub.path)) {
+			continue
+		}
+
+		select {
+		case sub.changes <- out:
+		default:
+			// Closing the channel makes the subscriber disconnect, so it knows that it has missed changes
+			delete(self.subscribers, sub)
+			close(sub.changes)
+		}
+	}
+}
+
+func isBelow(path string, root string) bool {
+	return root == "/" || path == root || strings.HasPrefix(path, root+"/")
+}
@@ -0,0 +1,55 @@
+package drive
+
+import (
+	"time"
+
+	"github.com/henrybear327/go-proton-api"
+)
+
+// Device is a computer that the desktop clients back up into its own share. Devices are identified by their share.
+type Device struct {
+	share *Share
+	root  *Link
+}
+
+func (self *Device) ID() string {
+	return self.share.ID()
+}
+
+func (self *Device) Name() string {
+	return self.share.Name()
+}
+
+func (self *Device) Share() *Share {
+	return self.share
+}
+
+// Root returns the folder the device is mounted as. It can be used with the FileSystem like any other folder.
+func (self *Device) Root() *Link {
+	return self.root
+}
+
+// LastSync returns when the share of the device was last modified.
+func (self *Device) LastSync() time.Time {
+	return self.share.ModificationTime()
+}
+
+// Devices returns the devices that are mounted in the link tree. Where they are mounted is set with Links.SetMount.
+func (self *Session) Devices() []*Device {
+	devices := []*Device{}
+
+	for _, share := range self.links.Shares() {
+		if share.Type() != proton.ShareTypeDevice {
+			continue
+		}
+
+		root := self.links.LinkFromID(share.LinkID())
+		if root == nil {
+			continue
+		}
+
+		devices = append(devices, &Device{share: share, root: root})
+	}
+
+	return devices
+}
@@ -2,11 +2,17 @@ package drive
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/henrybear327/go-proton-api"
 )
 
+var (
+	ErrShareNotUpdated = errors.New("share is not kept up to date")
+)
+
 type EventLoop struct {
 	//
 	// PARAMETERS
@@ -19,7 +25,8 @@ type EventLoop struct {
 	// INTERNAL STATE
 	//
 
-	nextEvent string
+	// Shares are polled separately, keyed by share ID
+	nextEvent map[string]string
 
 	triggerUpdate chan struct{}
 	waitUpdate    chan struct{}
@@ -28,10 +35,20 @@ type EventLoop struct {
 func (self *EventLoop) Init(ctx context.Context) error {
 	self.triggerUpdate = make(chan struct{})
 	self.waitUpdate = make(chan struct{})
+	self.nextEvent = map[string]string{}
 
-	err := self.getNextEvent(ctx)
-	if err != nil {
-		return err
+	for _, share := range self.links.Shares() {
+		err := self.getNextEvent(ctx, share)
+		if err == nil {
+			continue
+		}
+
+		// Only the main share is required, other shares stay in the tree without being kept up to date
+		if share == self.links.Share() || ctx.Err() != nil {
+			return err
+		}
+
+		self.links.callOnShareError(share, fmt.Errorf("%w: %w", ErrShareNotUpdated, err))
 	}
 
 	go func() {
@@ -50,25 +67,9 @@ func (self *EventLoop) Init(ctx context.Context) error {
 				// ...
 			}
 
-			share := self.links.Share()
-
-			for {
-				event, err := self.client.GetShareEvent(ctx, share.ID(), self.nextEvent)
-				if err != nil {
-					continue
-				}
-
-				if len(event.Events) > 0 {
-					_ = self.handleEvents(event.Events)
-					self.nextEvent = event.EventID
-				}
-
-				if event.Refresh {
-					_ = self.getNextEvent(ctx)
-				}
-
-				if len(event.Events) == 0 {
-					break
+			for _, share := range self.links.Shares() {
+				if _, ok := self.nextEvent[share.ID()]; ok {
+					self.pollShare(ctx, share)
 				}
 			}
 
@@ -81,21 +82,42 @@ func (self *EventLoop) Init(ctx context.Context) error {
 	return nil
 }
 
-func (self *EventLoop) getNextEvent(ctx context.Context) error {
-	share := self.links.Share()
+// pollShare applies the events of a share until it has none left. Errors are retried on the next poll.
+func (self *EventLoop) pollShare(ctx context.Context, share *Share) {
+	for {
+		event, err := self.client.GetShareEvent(ctx, share.ID(), self.nextEvent[share.ID()])
+		if err != nil {
+			return
+		}
+
+		if len(event.Events) > 0 {
+			_ = self.handleEvents(ctx, event.Events)
+			self.nextEvent[share.ID()] = event.EventID
+		}
+
+		if event.Refresh {
+			_ = self.getNextEvent(ctx, share)
+		}
+
+		if len(event.Events) == 0 {
+			return
+		}
+	}
+}
 
+func (self *EventLoop) getNextEvent(ctx context.Context, share *Share) error {
 	eventID, err := self.client.GetLatestShareEventID(ctx, share.ID())
 	if err != nil {
 		return err
 	}
 
-	self.nextEvent = eventID
+	self.nextEvent[share.ID()] = eventID
 	return nil
 }
 
-func (self *EventLoop) handleEvents(events []proton.LinkEvent) error {
+func (self *EventLoop) handleEvents(ctx context.Context, events []proton.LinkEvent) error {
 	for _, event := range events {
-		err := self.links.OnEvent(event)
+		err := self.links.OnEvent(ctx, event)
 
 		if err != nil {
 			return err
@@ -0,0 +1,335 @@
+package fileserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	pathlib "path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+const (
+	indexName = "index.html"
+)
+
+var (
+	ErrNegativeOffset = errors.New("seek to negative offset")
+)
+
+// Handler serves the link tree read-only over HTTP. Files support range and conditional requests, folders are
+// rendered as HTML or JSON listings.
+type Handler struct {
+	//
+	// PARAMETERS
+	//
+
+	session *drive.Session
+}
+
+func NewHandler(session *drive.Session) *Handler {
+	return &Handler{session: session}
+}
+
+func (self *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := pathlib.Clean("/" + r.URL.Path)
+
+	link := self.session.Links().LinkFromPath(path)
+	if link == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Like http.FileServer, folders always end with a slash so relative links in listings resolve correctly
+	if link.IsDir() && !strings.HasSuffix(r.URL.Path, "/") {
+		redirect(w, r, pathlib.Base(path)+"/")
+		return
+	}
+
+	if link.IsFile() && strings.HasSuffix(r.URL.Path, "/") {
+		redirect(w, r, "../"+pathlib.Base(path))
+		return
+	}
+
+	if link.IsDir() {
+		index := self.session.Links().LinkFromPath(pathlib.Join(path, indexName))
+
+		if index == nil || !index.IsFile() || r.URL.Query().Get("format") != "" {
+			self.serveDir(w, r, link)
+			return
+		}
+
+		link = index
+	}
+
+	self.serveFile(w, r, link)
+}
+
+func redirect(w http.ResponseWriter, r *http.Request, target string) {
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
+}
+
+func (self *Handler) serveFile(w http.ResponseWriter, r *http.Request, link *drive.Link) {
+	reader := &lazyReader{
+		ctx:  r.Context(),
+		fs:   self.session.FileSystem(),
+		link: link,
+	}
+
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	w.Header().Set("ETag", `"`+link.RevisionID()+`"`)
+
+	if link.MIMEType() != "" {
+		w.Header().Set("Content-Type", link.MIMEType())
+	}
+
+	// Only ranges that are actually sent cause the file to be downloaded
+	http.ServeContent(w, r, link.Name(), link.ModificationTime(), reader)
+}
+
+type listEntry struct {
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	Size     int64     `json:"size"`
+	MIMEType string    `json:"mime_type,omitempty"`
+	Modified time.Time `json:"modified"`
+	ETag     string    `json:"etag,omitempty"`
+}
+
+func (self *Handler) serveDir(w http.ResponseWriter, r *http.Request, link *drive.Link) {
+	entries := []listEntry{}
+	modTime := link.ModificationTime()
+	hash := fnv.New64a()
+
+	for child := range link.Children().Iter() {
+		entry := listEntry{
+			Name:     child.Name(),
+			Type:     "file",
+			Size:     child.Size(),
+			MIMEType: child.MIMEType(),
+			Modified: child.ModificationTime(),
+			ETag:     child.RevisionID(),
+		}
+
+		if child.IsDir() {
+			entry.Type = "dir"
+			entry.Size = 0
+			entry.MIMEType = ""
+		}
+
+		if entry.Modified.After(modTime) {
+			modTime = entry.Modified
+		}
+
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if (entries[i].Type == "dir") != (entries[j].Type == "dir") {
+			return entries[i].Type == "dir"
+		}
+
+		return entries[i].Name < entries[j].Name
+	})
+
+	// The listing changes whenever a child is added, removed, renamed or gets a new revision
+	for _, entry := range entries {
+		_, _ = io.WriteString(hash, entry.Name+"\x00"+entry.ETag+"\x00")
+	}
+
+	buffer := &bytes.Buffer{}
+	asJSON := wantsJSON(r)
+
+	if asJSON {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(buffer).Encode(entries)
+	} else {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+		err := listingTemplate.Execute(buffer, map[string]any{
+			"Path":    strings.TrimSuffix(link.Path(), "/") + "/",
+			"Root":    link.IsRoot(),
+			"Entries": entries,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	etag := strconv.FormatUint(hash.Sum64(), 16)
+	if asJSON {
+		etag += "-json"
+	}
+
+	w.Header().Set("ETag", `W/"`+etag+`"`)
+	w.Header().Set("Vary", "Accept")
+
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(buffer.Bytes()))
+}
+
+func wantsJSON(r *http.Request) bool {
+	switch r.URL.Query().Get("format") {
+	case "json":
+		return true
+	case "html":
+		return false
+	}
+
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+var listingTemplate = template.Must(template.New("listing").Funcs(template.FuncMap{
+	"size": formatSize,
+	"href": func(name string) string {
+		return (&url.URL{Path: name}).String()
+	},
+	"time": func(t time.Time) string {
+		return t.UTC().Format("2006-01-02 15:04:05")
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Index of {{.Path}}</title>
+<style>
+body { font-family: sans-serif; }
+td { padding: 0.1em 1em 0.1em 0; }
+td.size { text-align: right; }
+</style>
+</head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+<tr><th>Name</th><th>Size</th><th>Modified</th></tr>
+{{- if not .Root}}
+<tr><td><a href="../">../</a></td><td></td><td></td></tr>
+{{- end}}
+{{- range .Entries}}
+{{- if eq .Type "dir"}}
+<tr><td><a href="{{href .Name}}/">{{.Name}}/</a></td><td class="size">-</td><td>{{time .Modified}}</td></tr>
+{{- else}}
+<tr><td><a href="{{href .Name}}">{{.Name}}</a></td><td class="size">{{size .Size}}</td><td>{{time .Modified}}</td></tr>
+{{- end}}
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+func formatSize(size int64) string {
+	const unit = 1024
+
+	if size < unit {
+		return strconv.FormatInt(size, 10) + " B"
+	}
+
+	value := float64(size)
+	suffixes := []string{"KiB", "MiB", "GiB", "TiB"}
+
+	for i := range suffixes {
+		value /= unit
+
+		if value < unit || i == len(suffixes)-1 {
+			return strconv.FormatFloat(value, 'f', 1, 64) + " " + suffixes[i]
+		}
+	}
+
+	return ""
+}
+
+// lazyReader only starts downloading a file once it is read. Seeking is answered from the link, so that requests
+// which end up without a body (HEAD, 304, 412) don't touch the file contents.
+type lazyReader struct {
+	//
+	// PARAMETERS
+	//
+
+	ctx  context.Context
+	fs   *drive.FileSystem
+	link *drive.Link
+
+	//
+	// INTERNAL STATE
+	//
+
+	reader *drive.FileReader
+	offset int64
+}
+
+func (self *lazyReader) Read(buffer []byte) (int, error) {
+	if self.reader == nil {
+		reader, err := self.fs.Download(self.ctx, self.link)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = reader.Seek(self.offset, io.SeekStart)
+		if err != nil {
+			_ = reader.Close()
+			return 0, err
+		}
+
+		self.reader = reader
+	}
+
+	n, err := self.reader.Read(buffer)
+	self.offset += int64(n)
+
+	return n, err
+}
+
+func (self *lazyReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += self.offset
+	case io.SeekEnd:
+		offset += self.link.Size()
+	}
+
+	if offset < 0 {
+		return 0, ErrNegativeOffset
+	}
+
+	if self.reader != nil {
+		_, err := self.reader.Seek(offset, io.SeekStart)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	self.offset = offset
+	return offset, nil
+}
+
+func (self *lazyReader) Close() error {
+	if self.reader == nil {
+		return nil
+	}
+
+	return self.reader.Close()
+}
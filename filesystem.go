@@ -3,7 +3,7 @@ package drive
 import (
 	"context"
 	"errors"
-	"mime"
+	"os"
 	pathlib "path"
 
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
@@ -11,9 +11,13 @@ import (
 )
 
 var (
-	ErrInvalidLink     = errors.New("invalid link")
-	ErrInvalidLinkType = errors.New("invalid link type, expected file")
-	ErrAlreadyExists   = errors.New("file or folder already exists")
+	ErrInvalidLink      = errors.New("invalid link")
+	ErrInvalidLinkType  = errors.New("invalid link type, expected file")
+	ErrAlreadyExists    = errors.New("file or folder already exists")
+	ErrRevisionConflict = errors.New("active revision does not match")
+	ErrMountPoint       = errors.New("virtual folders and share roots can't be modified")
+	ErrCrossShare       = errors.New("links can't be moved between shares")
+	ErrReadOnly         = errors.New("share is read-only")
 )
 
 type FileSystem struct {
@@ -50,42 +54,68 @@ func (self *FileSystem) Download(ctx context.Context, link *Link) (*FileReader,
 		ctx:    ctx,
 		client: self.client,
 		user:   self.user,
+		links:  self.links,
 		link:   link,
 		blocks: revision.Blocks,
 	}, nil
 }
 
-func (self *FileSystem) Upload(ctx context.Context, parent *Link, name string) (*FileWriter, error) {
+func (self *FileSystem) Upload(ctx context.Context, parent *Link, name string, opts ...Option) (*FileWriter, error) {
 	self.events.TriggerUpdate()
 
+	options := newOptions(opts)
+
 	parent = self.links.LinkFromID(parent.ID())
 	if parent == nil {
 		return nil, ErrInvalidLink
 	}
 
+	if parent.IsVirtual() {
+		return nil, ErrMountPoint
+	}
+
+	if parent.Share().ReadOnly() {
+		return nil, ErrReadOnly
+	}
+
+	name, err := self.resolveName(ctx, parent, name, options)
+	if err != nil {
+		return nil, err
+	}
+
 	link := self.links.LinkFromPath(pathlib.Join(parent.Path(), name))
-	if link == nil {
-		lid, rid, keyring, sessionKey, err := self.createFile(ctx, parent, name)
-		if err != nil {
-			return nil, err
+
+	switch options.createMode {
+	case CreateExclusive:
+		if link != nil {
+			return nil, ErrAlreadyExists
+		}
+	case CreateIfRevision:
+		if link == nil || link.RevisionID() != options.revisionID {
+			return nil, ErrRevisionConflict
 		}
+	}
 
+	if link == nil {
+		// The file is only created once the first block is available, so the MIME type can be detected from it
 		return &FileWriter{
 			ctx: ctx,
 
 			client: self.client,
-			events: self.events,
+			links:  self.links,
+			fs:     self,
 
-			parent:     parent,
-			linkID:     lid,
-			revisionID: rid,
+			parent:   parent,
+			name:     name,
+			mimeType: options.mimeType,
 
 			newFile: true,
-
-			keyring:    keyring,
-			sessionKey: sessionKey,
 		}, nil
 	} else {
+		if !link.IsFile() {
+			return nil, ErrInvalidLinkType
+		}
+
 		rid, err := self.createRevision(ctx, link)
 		if err != nil {
 			return nil, err
@@ -95,23 +125,60 @@ func (self *FileSystem) Upload(ctx context.Context, parent *Link, name string) (
 			ctx: ctx,
 
 			client: self.client,
-			events: self.events,
+			links:  self.links,
 
 			parent:     parent,
 			linkID:     link.ID(),
 			revisionID: rid,
 			newFile:    false,
 
+			expectedRevisionID: options.revisionID,
+
 			keyring:    link.Keyring(),
 			sessionKey: link.SessionKey(),
 		}, nil
 	}
 }
 
+func (self *FileSystem) UploadFile(ctx context.Context, parent *Link, localPath string, opts ...Option) (*Link, error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return nil, ErrInvalidLinkType
+	}
+
+	writer, err := self.Upload(ctx, parent, pathlib.Base(localPath), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	writer.SetModTime(info.ModTime())
+
+	_, err = writer.ReadFrom(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return writer.Commit()
+}
+
 func (self *FileSystem) createFile(
 	ctx context.Context,
 	parent *Link,
 	name string,
+	mimeType string,
 ) (string, string, *crypto.KeyRing, *crypto.SessionKey, error) {
 	share := parent.Share()
 	address := share.Address()
@@ -126,11 +193,6 @@ func (self *FileSystem) createFile(
 		return "", "", nil, nil, err
 	}
 
-	mimeType := mime.TypeByExtension(pathlib.Ext(name))
-	if mimeType == "" {
-		mimeType = "text/plain"
-	}
-
 	request := proton.CreateFileReq{
 		ParentLinkID:            parent.ID(),
 		SignatureAddress:        address.Email(),
@@ -156,6 +218,10 @@ func (self *FileSystem) createFile(
 	}
 
 	rsp, err := self.client.CreateFile(ctx, share.ID(), request)
+	if errors.Is(err, proton.ErrFileNameExist) || errors.Is(err, proton.ErrADraftExist) {
+		return "", "", nil, nil, ErrAlreadyExists
+	}
+
 	if err != nil {
 		return "", "", nil, nil, err
 	}
@@ -174,15 +240,49 @@ func (self *FileSystem) createRevision(ctx context.Context, link *Link) (string,
 	return rsp.ID, nil
 }
 
-func (self *FileSystem) Move(ctx context.Context, link *Link, parent *Link, name string) error {
+func (self *FileSystem) Move(
+	ctx context.Context,
+	link *Link,
+	parent *Link,
+	name string,
+	opts ...Option,
+) (*Link, error) {
 	self.events.TriggerUpdate()
 
+	options := newOptions(opts)
+
 	// Make sure the links are up-to-date
 	link = self.links.LinkFromID(link.ID())
 	parent = self.links.LinkFromID(parent.ID())
 
 	if link == nil || parent == nil {
-		return ErrInvalidLink
+		return nil, ErrInvalidLink
+	}
+
+	if link.IsVirtual() || link.IsShareRoot() || parent.IsVirtual() {
+		return nil, ErrMountPoint
+	}
+
+	if link.Share() != parent.Share() {
+		return nil, ErrCrossShare
+	}
+
+	if link.Share().ReadOnly() {
+		return nil, ErrReadOnly
+	}
+
+	// Moving a link onto itself shouldn't give it a new name
+	if self.links.LinkFromPath(pathlib.Join(parent.Path(), name)) != link {
+		resolved, err := self.resolveName(ctx, parent, name, options)
+		if err != nil {
+			return nil, err
+		}
+
+		name = resolved
+	}
+
+	if existing := self.links.LinkFromPath(pathlib.Join(parent.Path(), name)); existing != nil && existing != link {
+		return nil, ErrAlreadyExists
 	}
 
 	share := link.Share()
@@ -197,12 +297,12 @@ func (self *FileSystem) Move(ctx context.Context, link *Link, parent *Link, name
 
 	err := request.SetName(name, address.Keyring(), parent.Keyring())
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	err = request.SetHash(name, parent.HashKey())
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	nodePassphrase, err := reencryptKeyPacket(
@@ -213,19 +313,25 @@ func (self *FileSystem) Move(ctx context.Context, link *Link, parent *Link, name
 	)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	request.NodePassphrase = nodePassphrase
 	request.NodePassphraseSignature = link.NodePassphraseSignature()
 
+	// The tree may not know about the link that took the name yet
+	var apiErr *proton.APIError
+
 	err = self.client.MoveLink(ctx, share.ID(), link.ID(), request)
+	if errors.As(err, &apiErr) && apiErr.Code == proton.AFileOrFolderNameExist {
+		return nil, ErrAlreadyExists
+	}
+
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	self.events.TriggerUpdate()
-	return nil
+	return self.links.Refresh(ctx, share, link.ID())
 }
 
 func (self *FileSystem) Delete(ctx context.Context, link *Link) error {
@@ -236,6 +342,14 @@ func (self *FileSystem) Delete(ctx context.Context, link *Link) error {
 		return ErrInvalidLink
 	}
 
+	if link.IsVirtual() || link.IsShareRoot() {
+		return ErrMountPoint
+	}
+
+	if link.Share().ReadOnly() {
+		return ErrReadOnly
+	}
+
 	share := link.Share()
 	parent := link.Parent()
 
@@ -244,20 +358,35 @@ func (self *FileSystem) Delete(ctx context.Context, link *Link) error {
 		return err
 	}
 
-	self.events.TriggerUpdate()
+	self.links.Forget(link.ID())
 	return nil
 }
 
-func (self *FileSystem) CreateDir(ctx context.Context, parent *Link, name string) error {
+func (self *FileSystem) CreateDir(ctx context.Context, parent *Link, name string, opts ...Option) (*Link, error) {
 	self.events.TriggerUpdate()
 
+	options := newOptions(opts)
+
 	parent = self.links.LinkFromID(parent.ID())
 	if parent == nil {
-		return ErrInvalidLink
+		return nil, ErrInvalidLink
+	}
+
+	if parent.IsVirtual() {
+		return nil, ErrMountPoint
+	}
+
+	if parent.Share().ReadOnly() {
+		return nil, ErrReadOnly
+	}
+
+	name, err := self.resolveName(ctx, parent, name, options)
+	if err != nil {
+		return nil, err
 	}
 
 	if self.links.LinkFromPath(pathlib.Join(parent.Path(), name)) != nil {
-		return ErrAlreadyExists
+		return nil, ErrAlreadyExists
 	}
 
 	share := parent.Share()
@@ -265,7 +394,7 @@ func (self *FileSystem) CreateDir(ctx context.Context, parent *Link, name string
 
 	nodeKey, nodePassEnc, nodePassSig, err := generateNodeKeys(parent.Keyring(), address.Keyring())
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	request := proton.CreateFolderReq{
@@ -278,29 +407,32 @@ func (self *FileSystem) CreateDir(ctx context.Context, parent *Link, name string
 
 	err = request.SetName(name, address.Keyring(), parent.Keyring())
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	err = request.SetHash(name, parent.HashKey())
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	keyring, err := getKeyRing(parent.Keyring(), address.Keyring(), nodeKey, nodePassEnc, nodePassSig)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	err = request.SetNodeHashKey(keyring)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	rsp, err := self.client.CreateFolder(ctx, share.ID(), request)
+	if errors.Is(err, proton.ErrFolderNameExist) {
+		return nil, ErrAlreadyExists
 	}
 
-	_, err = self.client.CreateFolder(ctx, share.ID(), request)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	self.events.TriggerUpdate()
-	return nil
+	return self.links.Refresh(ctx, share, rsp.ID)
 }
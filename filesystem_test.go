@@ -0,0 +1,47 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// testFileSystem returns a file system on the tree, with an event loop that answers updates without polling.
+func testFileSystem(t *testing.T, links *Links) *FileSystem {
+	events := &EventLoop{
+		links:         links,
+		triggerUpdate: make(chan struct{}),
+		waitUpdate:    make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-events.triggerUpdate:
+				events.waitUpdate <- struct{}{}
+			}
+		}
+	}()
+
+	return &FileSystem{links: links, events: events}
+}
+
+func TestMoveOntoExisting(t *testing.T) {
+	links := testLinks()
+
+	dir := testLink(links.share, "dir", "Documents", links.root)
+	file := testLink(links.share, "file", "report.pdf", links.root)
+	testLink(links.share, "existing", "report.pdf", dir)
+
+	links.getLinkMaps()
+
+	_, err := testFileSystem(t, links).Move(context.Background(), file, dir, "report.pdf")
+	if !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("got %v, want %v", err, ErrAlreadyExists)
+	}
+}
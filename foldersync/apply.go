@@ -0,0 +1,397 @@
+package foldersync
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	pathlib "path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+var (
+	ErrChangedDuringSync = errors.New("changed during sync, retrying with the next sync")
+	ErrFolderNotEmpty    = errors.New("folder is not empty")
+)
+
+// Format of the timestamp in the names of conflicted copies
+const conflictTimeFormat = "2006-01-02 150405"
+
+// applier executes the actions of a plan and updates the state for every action that succeeded.
+type applier struct {
+	session   *drive.Session
+	localRoot string
+	root      *drive.Link
+	state     *state
+}
+
+func (self *applier) localPath(path string) string {
+	return filepath.Join(self.localRoot, filepath.FromSlash(path))
+}
+
+func (self *applier) remoteLink(path string) *drive.Link {
+	return self.session.Links().LinkFromPath(pathlib.Join(self.root.Path(), path))
+}
+
+func (self *applier) remoteParent(path string) (*drive.Link, error) {
+	parent := self.remoteLink(pathlib.Dir(path))
+	if parent == nil || !parent.IsDir() {
+		return nil, fmt.Errorf("%s: parent folder: %w", path, fs.ErrNotExist)
+	}
+
+	return parent, nil
+}
+
+// current returns the up-to-date version of a remote link, or nil if it was deleted.
+func (self *applier) current(link *drive.Link) *drive.Link {
+	if link == nil {
+		return nil
+	}
+
+	return self.session.Links().LinkFromID(link.ID())
+}
+
+// at reports whether a remote link is still at the path it had when the plan was made.
+func (self *applier) at(link *drive.Link, path string) bool {
+	return link.Path() == pathlib.Join(self.root.Path(), path)
+}
+
+// unchanged checks that a local path still looks like it did when the plan was made.
+func (self *applier) unchanged(path string, local *localFile) error {
+	info, err := os.Lstat(self.localPath(path))
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && local == nil:
+		return nil
+	case err != nil && local == nil:
+		return err
+	case err != nil:
+		return ErrChangedDuringSync
+	case local == nil || !local.matches(info):
+		return ErrChangedDuringSync
+	}
+
+	return nil
+}
+
+func (self *applier) apply(ctx context.Context, action *Action) error {
+	switch action.Type {
+	case ActionCreateLocalDir:
+		return self.createLocalDir(action.Path, action.remote)
+	case ActionCreateRemoteDir:
+		return self.createRemoteDir(ctx, action.Path)
+	case ActionUpload:
+		return self.upload(ctx, action)
+	case ActionDownload:
+		return self.download(ctx, action, action.local)
+	case ActionConflict:
+		return self.conflict(ctx, action)
+	case ActionDeleteLocal:
+		return self.deleteLocal(action)
+	case ActionDeleteRemote:
+		return self.deleteRemote(ctx, action)
+	}
+
+	return nil
+}
+
+func (self *applier) createLocalDir(path string, remote *drive.Link) error {
+	remote = self.current(remote)
+	if remote == nil || !self.at(remote, path) {
+		return ErrChangedDuringSync
+	}
+
+	err := os.Mkdir(self.localPath(path), 0o755)
+	if err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+
+	self.state.Records[path] = &record{Dir: true, LinkID: remote.ID()}
+	return nil
+}
+
+func (self *applier) createRemoteDir(ctx context.Context, path string) error {
+	link := self.remoteLink(path)
+
+	if link == nil {
+		parent, err := self.remoteParent(path)
+		if err != nil {
+			return err
+		}
+
+		link, err = self.session.FileSystem().CreateDir(ctx, parent, pathlib.Base(path))
+		if err != nil {
+			return err
+		}
+	}
+
+	if !link.IsDir() {
+		return ErrChangedDuringSync
+	}
+
+	self.state.Records[path] = &record{Dir: true, LinkID: link.ID()}
+	return nil
+}
+
+func (self *applier) upload(ctx context.Context, action *Action) error {
+	file, err := os.Open(self.localPath(action.Path))
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if action.local == nil || !action.local.matches(info) {
+		return ErrChangedDuringSync
+	}
+
+	parent, err := self.remoteParent(action.Path)
+	if err != nil {
+		return err
+	}
+
+	// Never overwrite a remote file that changed since the plan was made
+	opts := []drive.Option{drive.WithCreateMode(drive.CreateExclusive)}
+
+	if action.remote != nil && action.record != nil {
+		opts = []drive.Option{drive.WithRevision(action.record.RevisionID)}
+	}
+
+	writer, err := self.session.FileSystem().Upload(ctx, parent, pathlib.Base(action.Path), opts...)
+	if errors.Is(err, drive.ErrAlreadyExists) || errors.Is(err, drive.ErrRevisionConflict) {
+		return ErrChangedDuringSync
+	}
+
+	if err != nil {
+		return err
+	}
+
+	writer.SetModTime(info.ModTime())
+
+	_, err = writer.ReadFrom(file)
+	if err != nil {
+		_ = writer.Abort()
+		return err
+	}
+
+	link, err := writer.Commit()
+	if errors.Is(err, drive.ErrRevisionConflict) {
+		return ErrChangedDuringSync
+	}
+
+	if err != nil {
+		return err
+	}
+
+	self.state.Records[action.Path] = &record{
+		Size:       info.Size(),
+		ModTime:    info.ModTime().UnixNano(),
+		Hash:       writer.Hash(),
+		LinkID:     link.ID(),
+		RevisionID: link.RevisionID(),
+	}
+
+	return nil
+}
+
+// download replaces the local file with the remote one, unless either of them changed since the plan was made.
+func (self *applier) download(ctx context.Context, action *Action, local *localFile) error {
+	path := action.Path
+
+	remote := self.current(action.remote)
+	if remote == nil || !self.at(remote, path) || remote.RevisionID() != action.remoteRevision {
+		return ErrChangedDuringSync
+	}
+
+	rec, err := downloadFile(ctx, self.session, remote, self.localPath(path), func() error {
+		return self.unchanged(path, local)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	self.state.Records[path] = rec
+	return nil
+}
+
+// downloadFile writes a remote file to a temporary file next to the target, and renames it over the target once it
+// is complete, so the target is never partially written. ready is called right before the rename and can abort it.
+// The returned record describes the new local file.
+func downloadFile(
+	ctx context.Context,
+	session *drive.Session,
+	link *drive.Link,
+	target string,
+	ready func() error,
+) (*record, error) {
+	reader, err := session.FileSystem().Download(ctx, link)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	file, err := os.CreateTemp(filepath.Dir(target), internalPrefix+"-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = os.Remove(file.Name())
+	}()
+
+	hash := sha1.New()
+
+	_, err = io.Copy(io.MultiWriter(file, hash), reader)
+
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Chtimes(file.Name(), link.ModificationTime(), link.ModificationTime())
+	if err != nil {
+		return nil, err
+	}
+
+	if ready != nil {
+		err = ready()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = os.Rename(file.Name(), target)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil, err
+	}
+
+	return &record{
+		Size:       info.Size(),
+		ModTime:    info.ModTime().UnixNano(),
+		Hash:       hex.EncodeToString(hash.Sum(nil)),
+		LinkID:     link.ID(),
+		RevisionID: link.RevisionID(),
+	}, nil
+}
+
+// conflict keeps the local version under a new name and replaces it with the remote one. The renamed copy is a new
+// local file, so the next pass uploads it.
+func (self *applier) conflict(ctx context.Context, action *Action) error {
+	err := self.unchanged(action.Path, action.local)
+	if err != nil {
+		return err
+	}
+
+	copyPath := conflictName(action.Path, action.local.dir, time.Now())
+
+	_, err = os.Lstat(self.localPath(copyPath))
+	if err == nil {
+		return fmt.Errorf("%s: %w", copyPath, fs.ErrExist)
+	}
+
+	err = os.Rename(self.localPath(action.Path), self.localPath(copyPath))
+	if err != nil {
+		return err
+	}
+
+	delete(self.state.Records, action.Path)
+
+	if action.remote.IsDir() {
+		return self.createLocalDir(action.Path, action.remote)
+	}
+
+	return self.download(ctx, action, nil)
+}
+
+func (self *applier) deleteLocal(action *Action) error {
+	path := self.localPath(action.Path)
+
+	err := self.unchanged(action.Path, action.local)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if err != nil && action.local.dir {
+		// Something new was added to the folder, it is picked up by the next sync
+		_, readErr := os.ReadDir(path)
+		if readErr == nil {
+			return ErrFolderNotEmpty
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	delete(self.state.Records, action.Path)
+	return nil
+}
+
+func (self *applier) deleteRemote(ctx context.Context, action *Action) error {
+	link := self.current(action.remote)
+	if link == nil {
+		delete(self.state.Records, action.Path)
+		return nil
+	}
+
+	if !self.at(link, action.Path) || link.RevisionID() != action.record.RevisionID {
+		return ErrChangedDuringSync
+	}
+
+	if link.IsDir() && link.Children().Cardinality() > 0 {
+		return ErrFolderNotEmpty
+	}
+
+	err := self.session.FileSystem().Delete(ctx, link)
+	if err != nil {
+		return err
+	}
+
+	delete(self.state.Records, action.Path)
+	return nil
+}
+
+// conflictName returns the path of the copy that keeps the local version of a conflicting file, like
+// "name (conflicted copy 2006-01-02 150405).ext".
+func conflictName(path string, dir bool, now time.Time) string {
+	base := pathlib.Base(path)
+	ext := ""
+
+	if !dir {
+		ext = pathlib.Ext(base)
+	}
+
+	name := strings.TrimSuffix(base, ext)
+	name = fmt.Sprintf("%s (conflicted copy %s)%s", name, now.Format(conflictTimeFormat), ext)
+
+	return pathlib.Join(pathlib.Dir(path), name)
+}
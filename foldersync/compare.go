@@ -0,0 +1,252 @@
+package foldersync
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	pathlib "path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+type DifferenceType int
+
+const (
+	// Only exists locally
+	DifferenceMissing DifferenceType = iota
+
+	// Only exists remotely
+	DifferenceExtra
+
+	// A file on one side and a folder on the other
+	DifferenceFileType
+	DifferenceSize
+	DifferenceHash
+	DifferenceModTime
+)
+
+var differenceNames = map[DifferenceType]string{
+	DifferenceMissing:  "missing",
+	DifferenceExtra:    "extra",
+	DifferenceFileType: "type-mismatch",
+	DifferenceSize:     "size-mismatch",
+	DifferenceHash:     "hash-mismatch",
+	DifferenceModTime:  "mtime-drift",
+}
+
+func (self DifferenceType) String() string {
+	return differenceNames[self]
+}
+
+func (self DifferenceType) MarshalText() ([]byte, error) {
+	return []byte(self.String()), nil
+}
+
+// Difference is a path that doesn't match between the local and the remote folder. Local and Remote hold the
+// values that differ, if there are any.
+type Difference struct {
+	Type   DifferenceType `json:"type"`
+	Path   string         `json:"path"`
+	Local  string         `json:"local,omitempty"`
+	Remote string         `json:"remote,omitempty"`
+}
+
+func (self *Difference) String() string {
+	if self.Local == "" && self.Remote == "" {
+		return fmt.Sprintf("%-13s %s", self.Type, self.Path)
+	}
+
+	return fmt.Sprintf("%-13s %s (local %s, remote %s)", self.Type, self.Path, self.Local, self.Remote)
+}
+
+type CompareOptions struct {
+	// Report files whose modification times differ by more than the tolerance
+	ModTime          bool
+	ModTimeTolerance time.Duration
+}
+
+type Report struct {
+	Local  string `json:"local"`
+	Remote string `json:"remote"`
+
+	Files   int `json:"files"`
+	Folders int `json:"folders"`
+
+	// Files whose remote hash wasn't stored, so they had to be downloaded
+	Downloaded int `json:"downloaded"`
+
+	Differences []*Difference `json:"differences"`
+}
+
+// Compare walks a local folder and a remote folder and reports every difference between them. Contents are
+// compared by SHA1, remote files are only downloaded if their hash is unknown.
+func Compare(
+	ctx context.Context,
+	session *drive.Session,
+	localRoot string,
+	remotePath string,
+	options CompareOptions,
+) (*Report, error) {
+	remotePath = pathlib.Clean("/" + remotePath)
+
+	root := session.Links().LinkFromPath(remotePath)
+	if root == nil {
+		return nil, fmt.Errorf("%s: %w", remotePath, os.ErrNotExist)
+	}
+
+	if !root.IsDir() {
+		return nil, fmt.Errorf("%s: not a folder: %w", remotePath, drive.ErrInvalidLinkType)
+	}
+
+	local, err := scanLocal(localRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	remote := scanRemote(root)
+
+	report := &Report{
+		Local:       localRoot,
+		Remote:      remotePath,
+		Differences: []*Difference{},
+	}
+
+	paths := []string{}
+
+	for path := range local {
+		paths = append(paths, path)
+	}
+
+	for path := range remote {
+		if _, ok := local[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		file, link := local[path], remote[path]
+
+		if file != nil && file.dir || link != nil && link.IsDir() {
+			report.Folders++
+		} else {
+			report.Files++
+		}
+
+		localPath := filepath.Join(localRoot, filepath.FromSlash(path))
+
+		difference, err := compare(ctx, session, report, localPath, file, link, options)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		if difference == nil {
+			continue
+		}
+
+		difference.Path = path
+		report.Differences = append(report.Differences, difference)
+	}
+
+	return report, nil
+}
+
+func compare(
+	ctx context.Context,
+	session *drive.Session,
+	report *Report,
+	localPath string,
+	file *localFile,
+	link *drive.Link,
+	options CompareOptions,
+) (*Difference, error) {
+	switch {
+	case link == nil:
+		return &Difference{Type: DifferenceMissing}, nil
+	case file == nil:
+		return &Difference{Type: DifferenceExtra}, nil
+	case file.dir != link.IsDir():
+		return &Difference{Type: DifferenceFileType, Local: typeName(file.dir), Remote: typeName(link.IsDir())}, nil
+	case file.dir:
+		return nil, nil
+	case file.size != link.Size():
+		return &Difference{
+			Type:   DifferenceSize,
+			Local:  strconv.FormatInt(file.size, 10),
+			Remote: strconv.FormatInt(link.Size(), 10),
+		}, nil
+	}
+
+	localHash, err := hashFile(localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	remoteHash := link.ContentHash()
+
+	if remoteHash == "" {
+		remoteHash, err = hashRemote(ctx, session, link)
+		if err != nil {
+			return nil, err
+		}
+
+		report.Downloaded++
+	}
+
+	if localHash != remoteHash {
+		return &Difference{Type: DifferenceHash, Local: localHash, Remote: remoteHash}, nil
+	}
+
+	drift := file.modTime.Sub(link.ModificationTime()).Abs()
+
+	if options.ModTime && drift > options.ModTimeTolerance {
+		return &Difference{
+			Type:   DifferenceModTime,
+			Local:  file.modTime.Format(time.RFC3339Nano),
+			Remote: link.ModificationTime().Format(time.RFC3339Nano),
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// hashRemote downloads a file to compute its SHA1, for files that were uploaded without one.
+func hashRemote(ctx context.Context, session *drive.Session, link *drive.Link) (string, error) {
+	reader, err := session.FileSystem().Download(ctx, link)
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	hash := sha1.New()
+
+	_, err = io.Copy(hash, reader)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func typeName(dir bool) string {
+	if dir {
+		return "folder"
+	}
+
+	return "file"
+}
@@ -0,0 +1,265 @@
+package foldersync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	pathlib "path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+const (
+	DefaultMaxDeletes       = 1000
+	DefaultMaxDeletePercent = 50
+
+	// Deleting a few files from a small tree shouldn't trip the percentage limit
+	minDeletesForPercent = 10
+)
+
+var (
+	ErrTooManyDeletes = errors.New("too many deletes, refusing to sync")
+	ErrIncomplete     = errors.New("some actions failed")
+)
+
+// Engine keeps a local folder and a remote folder in sync. Changes on either side are detected by comparing both
+// sides against the state of the last sync, which is stored in a file in the local folder.
+type Engine struct {
+	//
+	// PARAMETERS
+	//
+
+	session    *drive.Session
+	localRoot  string
+	remotePath string
+	statePath  string
+
+	maxDeletes       int
+	maxDeletePercent int
+
+	//
+	// INTERNAL STATE
+	//
+
+	changed <-chan struct{}
+	lock    sync.Mutex
+}
+
+func NewEngine(session *drive.Session, localRoot string, remotePath string) *Engine {
+	self := &Engine{
+		session:          session,
+		localRoot:        localRoot,
+		remotePath:       pathlib.Clean("/" + remotePath),
+		statePath:        filepath.Join(localRoot, DefaultStateName),
+		maxDeletes:       DefaultMaxDeletes,
+		maxDeletePercent: DefaultMaxDeletePercent,
+		changed:          watchRemote(session, remotePath),
+	}
+
+	return self
+}
+
+func (self *Engine) SetStatePath(path string) {
+	self.statePath = path
+}
+
+// SetDeleteLimits sets how many files and folders a single sync may delete, in total and in percent of the synced
+// files. Zero disables a limit.
+func (self *Engine) SetDeleteLimits(maxCount int, maxPercent int) {
+	self.maxDeletes = maxCount
+	self.maxDeletePercent = maxPercent
+}
+
+// watchRemote returns a channel that receives a value when something below a remote folder changed. Changes that
+// happen before the value was received are merged into it.
+func watchRemote(session *drive.Session, path string) <-chan struct{} {
+	root := pathlib.Clean("/" + path)
+	changed := make(chan struct{}, 1)
+
+	session.Links().OnChange(func(change drive.Change) {
+		if !isBelow(change.Path, root) && (change.OldPath == "" || !isBelow(change.OldPath, root)) {
+			return
+		}
+
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+
+	return changed
+}
+
+func (self *Engine) remoteRoot() (*drive.Link, error) {
+	root := self.session.Links().LinkFromPath(self.remotePath)
+	if root == nil {
+		return nil, fmt.Errorf("%s: %w", self.remotePath, fs.ErrNotExist)
+	}
+
+	if !root.IsDir() {
+		return nil, fmt.Errorf("%s: not a folder: %w", self.remotePath, drive.ErrInvalidLinkType)
+	}
+
+	return root, nil
+}
+
+// Plan compares both sides and returns the actions that would bring them in step, without changing anything.
+func (self *Engine) Plan(ctx context.Context) (*Plan, error) {
+	// A missing local folder, e.g. an unmounted disk, must not look like everything was deleted
+	info, err := os.Stat(self.localRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s: not a folder: %w", self.localRoot, drive.ErrInvalidLinkType)
+	}
+
+	root, err := self.remoteRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := loadState(self.statePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPlan(self.localRoot, root, state)
+}
+
+// CheckLimits returns ErrTooManyDeletes if applying the plan would delete more than the configured limits allow.
+func (self *Engine) CheckLimits(plan *Plan) error {
+	deletes := plan.Deletes()
+
+	if self.maxDeletes > 0 && deletes > self.maxDeletes {
+		return fmt.Errorf("%w: %d deletes, the limit is %d", ErrTooManyDeletes, deletes, self.maxDeletes)
+	}
+
+	total := len(plan.state.Records)
+
+	if self.maxDeletePercent > 0 && deletes >= minDeletesForPercent && deletes*100 > total*self.maxDeletePercent {
+		return fmt.Errorf(
+			"%w: %d of %d files, the limit is %d%%",
+			ErrTooManyDeletes, deletes, total, self.maxDeletePercent,
+		)
+	}
+
+	return nil
+}
+
+// Apply executes a plan and saves the new state. Actions that fail, or whose files changed since the plan was made,
+// are skipped and retried by the next sync; their Error is set and ErrIncomplete is returned.
+func (self *Engine) Apply(ctx context.Context, plan *Plan) (err error) {
+	err = self.CheckLimits(plan)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		saveErr := plan.state.save(self.statePath)
+		if err == nil {
+			err = saveErr
+		}
+	}()
+
+	for path, rec := range plan.records {
+		if rec == nil {
+			delete(plan.state.Records, path)
+		} else {
+			plan.state.Records[path] = rec
+		}
+	}
+
+	applier := &applier{
+		session:   self.session,
+		localRoot: self.localRoot,
+		root:      plan.remote,
+		state:     plan.state,
+	}
+
+	failed := 0
+
+	for _, action := range plan.Actions {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		actionErr := applier.apply(ctx, action)
+		if actionErr != nil {
+			action.Error = actionErr.Error()
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d", ErrIncomplete, failed, len(plan.Actions))
+	}
+
+	return nil
+}
+
+// Sync plans and applies in one go. Conflicted copies created by the first pass are uploaded by a second one.
+func (self *Engine) Sync(ctx context.Context) (*Plan, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	plan, err := self.Plan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = self.Apply(ctx, plan)
+	if err != nil || !plan.hasConflicts() {
+		return plan, err
+	}
+
+	second, err := self.Plan(ctx)
+	if err != nil {
+		return plan, err
+	}
+
+	err = self.Apply(ctx, second)
+	plan.Actions = append(plan.Actions, second.Actions...)
+
+	return plan, err
+}
+
+// Run syncs whenever the remote folder changes, and every interval to pick up local changes. Every pass is passed
+// to report. Failed actions are retried on the next pass, any other error stops the loop.
+func (self *Engine) Run(ctx context.Context, interval time.Duration, report func(*Plan, error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		plan, err := self.Sync(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if report != nil && (err != nil || len(plan.Actions) > 0) {
+			report(plan, err)
+		}
+
+		if err != nil && !errors.Is(err, ErrIncomplete) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-self.changed:
+		}
+	}
+}
+
+func isBelow(path string, root string) bool {
+	return root == "/" || path == root || strings.HasPrefix(path, root+"/")
+}
@@ -0,0 +1,303 @@
+package foldersync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	pathlib "path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+const (
+	DefaultMirrorStateName = internalPrefix + "-mirror.json"
+
+	// Changes arrive in bursts, e.g. when a folder is uploaded
+	mirrorSettleDelay = time.Second
+)
+
+// Mirror keeps a read-only local copy of a remote folder. It follows the changes reported by the link tree: new
+// revisions are downloaded, moves are applied as local renames and deleted files are removed. Local files that the
+// mirror didn't create are left alone, unless a remote file with the same name replaces them.
+type Mirror struct {
+	//
+	// PARAMETERS
+	//
+
+	session    *drive.Session
+	remotePath string
+	localRoot  string
+	statePath  string
+
+	//
+	// INTERNAL STATE
+	//
+
+	state   *state
+	changed <-chan struct{}
+	report  func(*Action)
+}
+
+func NewMirror(session *drive.Session, remotePath string, localRoot string) *Mirror {
+	return &Mirror{
+		session:    session,
+		remotePath: pathlib.Clean("/" + remotePath),
+		localRoot:  localRoot,
+		statePath:  filepath.Join(localRoot, DefaultMirrorStateName),
+		changed:    watchRemote(session, remotePath),
+	}
+}
+
+func (self *Mirror) SetStatePath(path string) {
+	self.statePath = path
+}
+
+// Run updates the local copy until the context is cancelled. The local folder is checked against the state once at
+// the start, after that only remote changes are applied. Every interval the tree is compared again, which retries
+// failed downloads. Every change is passed to report.
+func (self *Mirror) Run(ctx context.Context, interval time.Duration, report func(*Action)) (err error) {
+	self.report = report
+
+	err = os.MkdirAll(self.localRoot, 0o755)
+	if err != nil {
+		return err
+	}
+
+	self.state, err = loadState(self.statePath)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		saveErr := self.state.save(self.statePath)
+		if err == nil {
+			err = saveErr
+		}
+	}()
+
+	err = self.update(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-self.changed:
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(mirrorSettleDelay):
+			}
+		}
+
+		err = self.update(ctx, false)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (self *Mirror) localPath(path string) string {
+	return filepath.Join(self.localRoot, filepath.FromSlash(path))
+}
+
+// update brings the local copy in line with the remote folder. With verify, the local files are checked as well,
+// otherwise they are assumed to match the state.
+func (self *Mirror) update(ctx context.Context, verify bool) error {
+	root := self.session.Links().LinkFromPath(self.remotePath)
+	if root == nil {
+		return fmt.Errorf("%s: %w", self.remotePath, fs.ErrNotExist)
+	}
+
+	if !root.IsDir() {
+		return fmt.Errorf("%s: not a folder: %w", self.remotePath, drive.ErrInvalidLinkType)
+	}
+
+	remote := scanRemote(root)
+
+	var local map[string]*localFile
+
+	if verify {
+		var err error
+
+		local, err = scanLocal(self.localRoot)
+		if err != nil {
+			return err
+		}
+	}
+
+	paths := make([]string, 0, len(remote))
+
+	for path := range remote {
+		paths = append(paths, path)
+	}
+
+	// Parents first, so folders exist before their contents are moved or downloaded into them
+	sort.Strings(paths)
+
+	// Local paths by link, to recognize moves
+	moved := map[string]string{}
+
+	for path, rec := range self.state.Records {
+		if remote[path] == nil || remote[path].ID() != rec.LinkID {
+			moved[rec.LinkID] = path
+		}
+	}
+
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		link := remote[path]
+		rec := self.state.Records[path]
+
+		oldPath, ok := moved[link.ID()]
+		oldRec := self.state.Records[oldPath]
+
+		if ok && (rec == nil || rec.LinkID != link.ID()) && oldRec != nil && oldRec.LinkID == link.ID() {
+			err := self.rename(oldPath, path)
+			emit(self.report, ActionMoveLocal, path, "moved from "+oldPath, err)
+
+			rec = self.state.Records[path]
+		}
+
+		if link.IsDir() {
+			self.updateDir(path, link, rec, verify)
+		} else {
+			self.updateFile(ctx, path, link, rec, local)
+		}
+	}
+
+	self.removeDeleted(remote)
+	return nil
+}
+
+func (self *Mirror) rename(oldPath string, newPath string) error {
+	// Whatever the mirror put there before belongs to a link that is gone now
+	self.remove(newPath)
+
+	err := os.MkdirAll(filepath.Dir(self.localPath(newPath)), 0o755)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(self.localPath(oldPath), self.localPath(newPath))
+	if err != nil {
+		return err
+	}
+
+	renamePaths(self.state.Records, oldPath, newPath)
+	return nil
+}
+
+func (self *Mirror) updateDir(path string, link *drive.Link, rec *record, verify bool) {
+	if !verify && rec != nil && rec.Dir && rec.LinkID == link.ID() {
+		return
+	}
+
+	if rec != nil && !rec.Dir {
+		self.remove(path)
+	}
+
+	err := os.MkdirAll(self.localPath(path), 0o755)
+	if rec == nil || err != nil {
+		emit(self.report, ActionCreateLocalDir, path, "new remote folder", err)
+	}
+
+	if err == nil {
+		self.state.Records[path] = &record{Dir: true, LinkID: link.ID()}
+	}
+}
+
+func (self *Mirror) updateFile(
+	ctx context.Context,
+	path string,
+	link *drive.Link,
+	rec *record,
+	local map[string]*localFile,
+) {
+	reason := "new remote file"
+
+	if rec != nil && rec.LinkID == link.ID() && !rec.Dir {
+		reason = "changed remotely"
+
+		if rec.RevisionID == link.RevisionID() {
+			if local == nil || local[path] != nil && local[path].matchesRecord(rec) {
+				return
+			}
+
+			reason = "changed locally"
+		}
+	}
+
+	if rec != nil && rec.Dir {
+		self.remove(path)
+	}
+
+	target := self.localPath(path)
+
+	err := os.MkdirAll(filepath.Dir(target), 0o755)
+	if err == nil {
+		rec, err = downloadFile(ctx, self.session, link, target, nil)
+	}
+
+	emit(self.report, ActionDownload, path, reason, err)
+
+	if err == nil {
+		self.state.Records[path] = rec
+	}
+}
+
+// removeDeleted removes the local copies of links that are no longer in the remote folder.
+func (self *Mirror) removeDeleted(remote map[string]*drive.Link) {
+	paths := []string{}
+
+	for path := range self.state.Records {
+		if remote[path] == nil {
+			paths = append(paths, path)
+		}
+	}
+
+	// Contents before their folders
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+
+	for _, path := range paths {
+		err := os.Remove(self.localPath(path))
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+
+		emit(self.report, ActionDeleteLocal, path, "deleted remotely", err)
+		delete(self.state.Records, path)
+	}
+}
+
+// remove deletes the local copy of a path and everything below it that the mirror created.
+func (self *Mirror) remove(path string) {
+	paths := []string{}
+
+	for name := range self.state.Records {
+		if isBelow(name, path) {
+			paths = append(paths, name)
+		}
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+
+	for _, name := range paths {
+		_ = os.Remove(self.localPath(name))
+		delete(self.state.Records, name)
+	}
+}
@@ -0,0 +1,418 @@
+package foldersync
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+type ActionType int
+
+const (
+	ActionCreateLocalDir ActionType = iota
+	ActionCreateRemoteDir
+	ActionUpload
+	ActionDownload
+	ActionConflict
+	ActionDeleteLocal
+	ActionDeleteRemote
+	ActionMoveRemote
+	ActionMoveLocal
+)
+
+var actionNames = map[ActionType]string{
+	ActionCreateLocalDir:  "mkdir-local",
+	ActionCreateRemoteDir: "mkdir-remote",
+	ActionUpload:          "upload",
+	ActionDownload:        "download",
+	ActionConflict:        "conflict",
+	ActionDeleteLocal:     "delete-local",
+	ActionDeleteRemote:    "delete-remote",
+	ActionMoveRemote:      "move-remote",
+	ActionMoveLocal:       "move-local",
+}
+
+func (self ActionType) String() string {
+	return actionNames[self]
+}
+
+func (self ActionType) MarshalText() ([]byte, error) {
+	return []byte(self.String()), nil
+}
+
+// Action is a single step of a plan.
+type Action struct {
+	Type   ActionType `json:"type"`
+	Path   string     `json:"path"`
+	Reason string     `json:"reason"`
+
+	// Set by Apply if the action failed
+	Error string `json:"error,omitempty"`
+
+	local  *localFile
+	remote *drive.Link
+	record *record
+
+	// Links are updated in place, so the revision has to be captured when planning
+	remoteRevision string
+}
+
+func (self *Action) String() string {
+	if self.Error != "" {
+		return fmt.Sprintf("%-13s %s (%s): %s", self.Type, self.Path, self.Reason, self.Error)
+	}
+
+	return fmt.Sprintf("%-13s %s (%s)", self.Type, self.Path, self.Reason)
+}
+
+func (self *Action) isDelete() bool {
+	return self.Type == ActionDeleteLocal || self.Type == ActionDeleteRemote
+}
+
+// emit passes an action that was executed right away, instead of being planned, to a report callback.
+func emit(report func(*Action), kind ActionType, path string, reason string, err error) {
+	if report == nil {
+		return
+	}
+
+	action := &Action{Type: kind, Path: path, Reason: reason}
+
+	if err != nil {
+		action.Error = err.Error()
+	}
+
+	report(action)
+}
+
+// Plan is the list of actions that bring both sides in step. It can be printed for a dry run, or applied.
+type Plan struct {
+	Actions []*Action `json:"actions"`
+
+	// Paths that are identical on both sides but whose record is missing or outdated
+	records map[string]*record
+
+	state  *state
+	remote *drive.Link
+}
+
+// Deletes returns the number of files and folders that the plan would delete on either side.
+func (self *Plan) Deletes() int {
+	count := 0
+
+	for _, action := range self.Actions {
+		if action.isDelete() {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (self *Plan) hasConflicts() bool {
+	for _, action := range self.Actions {
+		if action.Type == ActionConflict && action.Error == "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// planner compares the local scan, the remote tree and the state of the last sync for one path.
+type planner struct {
+	localRoot string
+
+	local  map[string]*localFile
+	remote map[string]*drive.Link
+	state  *state
+
+	plan *Plan
+}
+
+func (self *planner) add(kind ActionType, path string, reason string) {
+	action := &Action{
+		Type:   kind,
+		Path:   path,
+		Reason: reason,
+		local:  self.local[path],
+		remote: self.remote[path],
+		record: self.state.Records[path],
+	}
+
+	if action.remote != nil {
+		action.remoteRevision = action.remote.RevisionID()
+	}
+
+	self.plan.Actions = append(self.plan.Actions, action)
+}
+
+// localHash returns the SHA1 of a local file, hashing it only once per run.
+func (self *planner) localHash(path string) (string, error) {
+	local := self.local[path]
+
+	if local.hash == "" {
+		hash, err := hashFile(filepath.Join(self.localRoot, filepath.FromSlash(path)))
+		if err != nil {
+			return "", err
+		}
+
+		local.hash = hash
+	}
+
+	return local.hash, nil
+}
+
+func (self *planner) localChanged(path string) (bool, error) {
+	local := self.local[path]
+	rec := self.state.Records[path]
+
+	if rec == nil || rec.Dir != local.dir {
+		return true, nil
+	}
+
+	if local.dir || (local.size == rec.Size && local.modTime.UnixNano() == rec.ModTime) {
+		return false, nil
+	}
+
+	// Only the modification time changed, e.g. after a touch or a restore from backup
+	hash, err := self.localHash(path)
+	if err != nil {
+		return false, err
+	}
+
+	if hash == rec.Hash {
+		updated := *rec
+		updated.Size = local.size
+		updated.ModTime = local.modTime.UnixNano()
+
+		self.plan.records[path] = &updated
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (self *planner) remoteChanged(path string) bool {
+	remote := self.remote[path]
+	rec := self.state.Records[path]
+
+	if rec == nil || rec.Dir != remote.IsDir() || rec.LinkID != remote.ID() {
+		return true
+	}
+
+	return !remote.IsDir() && remote.RevisionID() != rec.RevisionID
+}
+
+// identical reports whether a local and a remote file have the same contents, so nothing has to be transferred.
+func (self *planner) identical(path string) (bool, error) {
+	local := self.local[path]
+	remote := self.remote[path]
+
+	if local.dir || remote.IsDir() {
+		return local.dir == remote.IsDir(), nil
+	}
+
+	if local.size != remote.Size() || remote.ContentHash() == "" {
+		return false, nil
+	}
+
+	hash, err := self.localHash(path)
+	if err != nil {
+		return false, err
+	}
+
+	return hash == remote.ContentHash(), nil
+}
+
+func (self *planner) compare(path string) error {
+	local, hasLocal := self.local[path]
+	remote, hasRemote := self.remote[path]
+	_, hasRecord := self.state.Records[path]
+
+	switch {
+	case hasLocal && hasRemote:
+		localChanged, err := self.localChanged(path)
+		if err != nil {
+			return err
+		}
+
+		remoteChanged := self.remoteChanged(path)
+
+		if !localChanged && !remoteChanged {
+			return nil
+		}
+
+		same, err := self.identical(path)
+		if err != nil {
+			return err
+		}
+
+		if same {
+			self.plan.records[path] = self.newRecord(path)
+			return nil
+		}
+
+		switch {
+		case localChanged && remoteChanged:
+			self.add(ActionConflict, path, "changed on both sides")
+		case local.dir != remote.IsDir():
+			self.add(ActionConflict, path, "file replaced by a folder")
+		case localChanged:
+			self.add(ActionUpload, path, "changed locally")
+		default:
+			self.add(ActionDownload, path, "changed remotely")
+		}
+	case hasLocal && !hasRecord:
+		if local.dir {
+			self.add(ActionCreateRemoteDir, path, "new local folder")
+		} else {
+			self.add(ActionUpload, path, "new local file")
+		}
+	case hasRemote && !hasRecord:
+		if remote.IsDir() {
+			self.add(ActionCreateLocalDir, path, "new remote folder")
+		} else {
+			self.add(ActionDownload, path, "new remote file")
+		}
+	case hasLocal:
+		// Deleted remotely, unless it was changed locally in the meantime
+		localChanged, err := self.localChanged(path)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case localChanged && local.dir:
+			self.add(ActionCreateRemoteDir, path, "deleted remotely, but changed locally")
+		case localChanged:
+			self.add(ActionUpload, path, "deleted remotely, but changed locally")
+		default:
+			self.add(ActionDeleteLocal, path, "deleted remotely")
+		}
+	case hasRemote:
+		// Deleted locally, unless it was changed remotely in the meantime
+		switch {
+		case self.remoteChanged(path) && remote.IsDir():
+			self.add(ActionCreateLocalDir, path, "deleted locally, but changed remotely")
+		case self.remoteChanged(path):
+			self.add(ActionDownload, path, "deleted locally, but changed remotely")
+		default:
+			self.add(ActionDeleteRemote, path, "deleted locally")
+		}
+	default:
+		// Deleted on both sides
+		self.plan.records[path] = nil
+	}
+
+	return nil
+}
+
+func (self *planner) newRecord(path string) *record {
+	local := self.local[path]
+	remote := self.remote[path]
+
+	return &record{
+		Dir:        local.dir,
+		Size:       local.size,
+		ModTime:    local.modTime.UnixNano(),
+		Hash:       local.hash,
+		LinkID:     remote.ID(),
+		RevisionID: remote.RevisionID(),
+	}
+}
+
+func newPlan(localRoot string, remoteRoot *drive.Link, state *state) (*Plan, error) {
+	local, err := scanLocal(localRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	planner := &planner{
+		localRoot: localRoot,
+		local:     local,
+		remote:    scanRemote(remoteRoot),
+		state:     state,
+		plan: &Plan{
+			records: map[string]*record{},
+			state:   state,
+			remote:  remoteRoot,
+		},
+	}
+
+	paths := map[string]struct{}{}
+
+	for path := range planner.local {
+		paths[path] = struct{}{}
+	}
+
+	for path := range planner.remote {
+		paths[path] = struct{}{}
+	}
+
+	for path := range state.Records {
+		paths[path] = struct{}{}
+	}
+
+	for path := range paths {
+		err := planner.compare(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	keepChangedDirs(planner.plan.Actions)
+	sortActions(planner.plan.Actions)
+
+	return planner.plan, nil
+}
+
+// keepChangedDirs turns the delete of a folder into a create if something inside of it is still being synced,
+// because the other side added or changed files in it after it was deleted.
+func keepChangedDirs(actions []*Action) {
+	for _, action := range actions {
+		if !action.isDelete() || !action.record.Dir {
+			continue
+		}
+
+		changed := false
+
+		for _, other := range actions {
+			if !other.isDelete() && strings.HasPrefix(other.Path, action.Path+"/") {
+				changed = true
+				break
+			}
+		}
+
+		if !changed {
+			continue
+		}
+
+		if action.Type == ActionDeleteLocal {
+			action.Type = ActionCreateRemoteDir
+			action.Reason = "deleted remotely, but changed locally"
+		} else {
+			action.Type = ActionCreateLocalDir
+			action.Reason = "deleted locally, but changed remotely"
+		}
+	}
+}
+
+// sortActions orders a plan so that folders are created before their contents, and deleted after them.
+func sortActions(actions []*Action) {
+	sort.SliceStable(actions, func(i, j int) bool {
+		a, b := actions[i], actions[j]
+
+		if a.isDelete() != b.isDelete() {
+			return !a.isDelete()
+		}
+
+		if a.isDelete() {
+			return a.Path > b.Path
+		}
+
+		return a.Path < b.Path
+	})
+}
@@ -0,0 +1,225 @@
+package foldersync
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+func testPlanner(t *testing.T) *planner {
+	return &planner{
+		localRoot: t.TempDir(),
+		local:     map[string]*localFile{},
+		remote:    map[string]*drive.Link{},
+		state:     &state{Version: stateVersion, Records: map[string]*record{}},
+		plan:      &Plan{records: map[string]*record{}},
+	}
+}
+
+// writeLocal creates a local file and adds it to the scan, as scanLocal would.
+func writeLocal(t *testing.T, self *planner, path string, data string) *localFile {
+	name := filepath.Join(self.localRoot, filepath.FromSlash(path))
+
+	err := os.MkdirAll(filepath.Dir(name), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(name, []byte(data), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	self.local[path] = newLocalFile(info)
+	return self.local[path]
+}
+
+func sha1Hex(data string) string {
+	sum := sha1.Sum([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func onlyAction(t *testing.T, self *planner) *Action {
+	if len(self.plan.Actions) != 1 {
+		t.Fatalf("got %d actions, want 1: %v", len(self.plan.Actions), self.plan.Actions)
+	}
+
+	return self.plan.Actions[0]
+}
+
+func TestCompareNewLocal(t *testing.T) {
+	self := testPlanner(t)
+
+	writeLocal(t, self, "file.txt", "data")
+	self.local["dir"] = &localFile{dir: true}
+
+	for _, path := range []string{"dir", "file.txt"} {
+		err := self.compare(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(self.plan.Actions) != 2 {
+		t.Fatalf("got %v", self.plan.Actions)
+	}
+
+	if action := self.plan.Actions[0]; action.Type != ActionCreateRemoteDir || action.Path != "dir" {
+		t.Errorf("got %v, want a remote folder", action)
+	}
+
+	if action := self.plan.Actions[1]; action.Type != ActionUpload || action.Path != "file.txt" {
+		t.Errorf("got %v, want an upload", action)
+	}
+}
+
+func TestCompareDeletedRemotely(t *testing.T) {
+	self := testPlanner(t)
+
+	local := writeLocal(t, self, "file.txt", "data")
+
+	self.state.Records["file.txt"] = &record{
+		Size:    local.size,
+		ModTime: local.modTime.UnixNano(),
+		Hash:    sha1Hex("data"),
+	}
+
+	err := self.compare("file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if action := onlyAction(t, self); action.Type != ActionDeleteLocal {
+		t.Errorf("got %v, want a local delete", action)
+	}
+}
+
+func TestCompareDeletedRemotelyChangedLocally(t *testing.T) {
+	self := testPlanner(t)
+
+	local := writeLocal(t, self, "file.txt", "new data")
+
+	self.state.Records["file.txt"] = &record{
+		Size:    4,
+		ModTime: local.modTime.UnixNano(),
+		Hash:    sha1Hex("data"),
+	}
+
+	err := self.compare("file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if action := onlyAction(t, self); action.Type != ActionUpload {
+		t.Errorf("got %v, want an upload", action)
+	}
+}
+
+func TestCompareOnlyModTimeChanged(t *testing.T) {
+	self := testPlanner(t)
+
+	local := writeLocal(t, self, "file.txt", "data")
+	old := local.modTime.Add(-time.Hour).UnixNano()
+
+	self.state.Records["file.txt"] = &record{Size: local.size, ModTime: old, Hash: sha1Hex("data")}
+
+	err := self.compare("file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The file is unchanged, so the remote delete is applied and the record gets the new time
+	if action := onlyAction(t, self); action.Type != ActionDeleteLocal {
+		t.Errorf("got %v, want a local delete", action)
+	}
+
+	if rec := self.plan.records["file.txt"]; rec == nil || rec.ModTime != local.modTime.UnixNano() {
+		t.Errorf("record wasn't updated: %v", rec)
+	}
+}
+
+func TestCompareDeletedOnBothSides(t *testing.T) {
+	self := testPlanner(t)
+
+	self.state.Records["file.txt"] = &record{Size: 4}
+
+	err := self.compare("file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(self.plan.Actions) != 0 {
+		t.Errorf("got %v, want no actions", self.plan.Actions)
+	}
+
+	if rec, ok := self.plan.records["file.txt"]; !ok || rec != nil {
+		t.Errorf("record wasn't removed")
+	}
+}
+
+func TestKeepChangedDirs(t *testing.T) {
+	actions := []*Action{
+		{Type: ActionDeleteLocal, Path: "kept", record: &record{Dir: true}},
+		{Type: ActionUpload, Path: "kept/new.txt"},
+		{Type: ActionDeleteRemote, Path: "restored", record: &record{Dir: true}},
+		{Type: ActionDownload, Path: "restored/sub/changed.txt"},
+		{Type: ActionDeleteLocal, Path: "gone", record: &record{Dir: true}},
+		{Type: ActionDeleteLocal, Path: "gone/old.txt", record: &record{}},
+		{Type: ActionDeleteRemote, Path: "file", record: &record{}},
+		{Type: ActionUpload, Path: "file/x"},
+		{Type: ActionDeleteLocal, Path: "prefix", record: &record{Dir: true}},
+		{Type: ActionUpload, Path: "prefix-other/file.txt"},
+	}
+
+	keepChangedDirs(actions)
+
+	expected := []ActionType{
+		ActionCreateRemoteDir,
+		ActionUpload,
+		ActionCreateLocalDir,
+		ActionDownload,
+		ActionDeleteLocal,
+		ActionDeleteLocal,
+		ActionDeleteRemote,
+		ActionUpload,
+		ActionDeleteLocal,
+		ActionUpload,
+	}
+
+	for i, action := range actions {
+		if action.Type != expected[i] {
+			t.Errorf("%s: got %s, want %s", action.Path, action.Type, expected[i])
+		}
+	}
+}
+
+func TestSortActions(t *testing.T) {
+	actions := []*Action{
+		{Type: ActionDeleteLocal, Path: "old"},
+		{Type: ActionUpload, Path: "dir/file.txt"},
+		{Type: ActionDeleteRemote, Path: "old/sub/file.txt"},
+		{Type: ActionCreateRemoteDir, Path: "dir"},
+		{Type: ActionDeleteLocal, Path: "old/sub"},
+		{Type: ActionDownload, Path: "a.txt"},
+	}
+
+	sortActions(actions)
+
+	expected := []string{"a.txt", "dir", "dir/file.txt", "old/sub/file.txt", "old/sub", "old"}
+
+	for i, action := range actions {
+		if action.Path != expected[i] {
+			t.Errorf("position %d: got %s, want %s", i, action.Path, expected[i])
+		}
+	}
+}
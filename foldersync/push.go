@@ -0,0 +1,526 @@
+package foldersync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	pathlib "path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+const (
+	DefaultPushStateName = internalPrefix + "-push.json"
+	DefaultPushDelay     = 2 * time.Second
+
+	// How long to wait before trying a failed upload again
+	pushRetryDelay = time.Minute
+)
+
+// Pusher uploads changes to a local folder as they happen, for backups. It never deletes anything remotely: files
+// that are deleted locally are kept, renames are applied as moves. A state file remembers what was uploaded, so a
+// restart only uploads files that changed in the meantime.
+type Pusher struct {
+	//
+	// PARAMETERS
+	//
+
+	session    *drive.Session
+	localRoot  string
+	remotePath string
+	statePath  string
+	delay      time.Duration
+
+	//
+	// INTERNAL STATE
+	//
+
+	state *state
+	dirty bool
+
+	// Paths waiting to be uploaded, with the time of the last change to them
+	pending map[string]time.Time
+
+	report func(*Action)
+}
+
+func NewPusher(session *drive.Session, localRoot string, remotePath string) *Pusher {
+	return &Pusher{
+		session:    session,
+		localRoot:  localRoot,
+		remotePath: pathlib.Clean("/" + remotePath),
+		statePath:  filepath.Join(localRoot, DefaultPushStateName),
+		delay:      DefaultPushDelay,
+	}
+}
+
+func (self *Pusher) SetStatePath(path string) {
+	self.statePath = path
+}
+
+// SetDelay sets how long a file has to stay unchanged before it is uploaded.
+func (self *Pusher) SetDelay(delay time.Duration) {
+	self.delay = delay
+}
+
+// Run watches the local folder and uploads changes until the context is cancelled. Every upload, folder and move
+// is passed to report, failed ones have their Error set and are retried later.
+func (self *Pusher) Run(ctx context.Context, report func(*Action)) (err error) {
+	self.report = report
+	self.pending = map[string]time.Time{}
+
+	self.state, err = loadState(self.statePath)
+	if err != nil {
+		return err
+	}
+
+	_, err = self.mkdirAll(ctx, self.remotePath)
+	if err != nil {
+		return err
+	}
+
+	// Start watching before scanning, so nothing that happens during the scan is missed
+	watcher, err := newWatcher(self.localRoot)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = watcher.Close()
+
+		for range watcher.Events() {
+		}
+	}()
+
+	defer func() {
+		saveErr := self.save()
+		if err == nil {
+			err = saveErr
+		}
+	}()
+
+	err = self.rescan(ctx)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(max(self.delay/2, 100*time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events():
+			if !ok {
+				return watcher.Err()
+			}
+
+			err = self.handle(ctx, event)
+		case <-ticker.C:
+			self.flush(ctx)
+			err = self.save()
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (self *Pusher) save() error {
+	if !self.dirty {
+		return nil
+	}
+
+	err := self.state.save(self.statePath)
+	if err != nil {
+		return err
+	}
+
+	self.dirty = false
+	return nil
+}
+
+func (self *Pusher) localPath(path string) string {
+	return filepath.Join(self.localRoot, filepath.FromSlash(path))
+}
+
+func (self *Pusher) handle(ctx context.Context, event watchEvent) error {
+	switch event.op {
+	case watchChange:
+		return self.queue(event.path, event.dir)
+	case watchRemove:
+		// Deleted files are kept remotely, they are just not tracked anymore
+		self.forget(event.path)
+	case watchRename:
+		return self.move(ctx, event.oldPath, event.path, event.dir)
+	case watchRescan:
+		return self.rescan(ctx)
+	}
+
+	return nil
+}
+
+// queue marks a path as changed. For folders everything inside of them is queued as well, because files can be
+// created before the folder is watched.
+func (self *Pusher) queue(path string, dir bool) error {
+	now := time.Now()
+	self.pending[path] = now
+
+	if !dir {
+		return nil
+	}
+
+	files, err := scanLocal(self.localPath(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for name := range files {
+		self.pending[pathlib.Join(path, name)] = now
+	}
+
+	return nil
+}
+
+// forget removes the records and pending uploads of a path and everything below it.
+func (self *Pusher) forget(path string) {
+	for name := range self.state.Records {
+		if isBelow(name, path) {
+			delete(self.state.Records, name)
+			self.dirty = true
+		}
+	}
+
+	for name := range self.pending {
+		if isBelow(name, path) {
+			delete(self.pending, name)
+		}
+	}
+}
+
+// move applies a local rename to the remote folder. If the file wasn't uploaded yet, or the move fails, it is
+// uploaded under the new name instead.
+func (self *Pusher) move(ctx context.Context, oldPath string, newPath string, dir bool) error {
+	renamePaths(self.pending, oldPath, newPath)
+
+	rec := self.state.Records[oldPath]
+	if rec == nil {
+		return self.queue(newPath, dir)
+	}
+
+	link := self.session.Links().LinkFromID(rec.LinkID)
+	if link == nil {
+		self.forget(oldPath)
+		return self.queue(newPath, dir)
+	}
+
+	parent, err := self.mkdirAll(ctx, pathlib.Join(self.remotePath, pathlib.Dir(newPath)))
+	if err == nil {
+		_, err = self.session.FileSystem().Move(ctx, link, parent, pathlib.Base(newPath))
+	}
+
+	// E.g. an editor that saves by renaming a temporary file over the original, if the temporary file was
+	// already uploaded. The old remote file is kept, like any other deleted file.
+	if err != nil {
+		self.forget(oldPath)
+
+		if !errors.Is(err, drive.ErrAlreadyExists) {
+			emit(self.report, ActionMoveRemote, newPath, "renamed from "+oldPath, err)
+		}
+
+		return self.queue(newPath, dir)
+	}
+
+	renamePaths(self.state.Records, oldPath, newPath)
+
+	self.dirty = true
+	emit(self.report, ActionMoveRemote, newPath, "renamed from "+oldPath, nil)
+
+	return nil
+}
+
+// rescan compares the whole local folder with the state, to find changes that happened while nothing was
+// watching. Files that were renamed in the meantime are recognized by their size, modification time and hash.
+func (self *Pusher) rescan(ctx context.Context) error {
+	local, err := scanLocal(self.localRoot)
+	if err != nil {
+		return err
+	}
+
+	// Files that are gone, by size and modification time
+	type key struct {
+		size    int64
+		modTime int64
+	}
+
+	vanished := map[key][]string{}
+
+	for path, rec := range self.state.Records {
+		if _, ok := local[path]; !ok && !rec.Dir {
+			vanished[key{rec.Size, rec.ModTime}] = append(vanished[key{rec.Size, rec.ModTime}], path)
+		}
+	}
+
+	paths := make([]string, 0, len(local))
+
+	for path := range local {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		file := local[path]
+		rec := self.state.Records[path]
+
+		if rec != nil && rec.Dir == file.dir && (file.dir || file.matchesRecord(rec)) {
+			continue
+		}
+
+		if rec == nil && !file.dir {
+			oldPath, err := self.findRenamed(vanished[key{file.size, file.modTime.UnixNano()}], path)
+			if err != nil {
+				return err
+			}
+
+			if oldPath != "" {
+				err = self.move(ctx, oldPath, path, false)
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+		}
+
+		// Due right away, the files weren't touched while nothing was watching
+		self.pending[path] = time.Time{}
+	}
+
+	for path := range self.state.Records {
+		if _, ok := local[path]; !ok {
+			self.forget(path)
+		}
+	}
+
+	return nil
+}
+
+// findRenamed returns the candidate that has the same contents as the file at path.
+func (self *Pusher) findRenamed(candidates []string, path string) (string, error) {
+	if len(candidates) == 0 {
+		return "", nil
+	}
+
+	hash, err := hashFile(self.localPath(path))
+	if err != nil {
+		return "", err
+	}
+
+	for _, candidate := range candidates {
+		rec := self.state.Records[candidate]
+
+		// Another file may have been matched to the same candidate already
+		if rec != nil && rec.Hash == hash {
+			return candidate, nil
+		}
+	}
+
+	return "", nil
+}
+
+// flush uploads everything that hasn't changed for the configured delay.
+func (self *Pusher) flush(ctx context.Context) {
+	now := time.Now()
+	due := []string{}
+
+	for path, last := range self.pending {
+		if now.Sub(last) >= self.delay {
+			due = append(due, path)
+		}
+	}
+
+	// Parents first, so folders are created before the files inside of them
+	sort.Strings(due)
+
+	for _, path := range due {
+		if ctx.Err() != nil {
+			return
+		}
+
+		delete(self.pending, path)
+
+		err := self.push(ctx, path)
+		if err != nil {
+			self.pending[path] = now.Add(pushRetryDelay)
+		}
+	}
+}
+
+func (self *Pusher) push(ctx context.Context, path string) error {
+	info, err := os.Lstat(self.localPath(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		emit(self.report, ActionUpload, path, "changed locally", err)
+		return err
+	}
+
+	rec := self.state.Records[path]
+
+	if info.IsDir() {
+		if rec != nil && rec.Dir {
+			return nil
+		}
+
+		link, err := self.mkdirAll(ctx, pathlib.Join(self.remotePath, path))
+		emit(self.report, ActionCreateRemoteDir, path, "new local folder", err)
+
+		if err != nil {
+			return err
+		}
+
+		self.state.Records[path] = &record{Dir: true, LinkID: link.ID()}
+		self.dirty = true
+
+		return nil
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	if rec != nil && !rec.Dir && rec.Size == info.Size() {
+		if rec.ModTime == info.ModTime().UnixNano() {
+			return nil
+		}
+
+		// Only the modification time changed
+		hash, err := hashFile(self.localPath(path))
+		if err == nil && hash == rec.Hash {
+			rec.ModTime = info.ModTime().UnixNano()
+			self.dirty = true
+
+			return nil
+		}
+	}
+
+	reason := "new local file"
+	if rec != nil {
+		reason = "changed locally"
+	}
+
+	err = self.upload(ctx, path, info)
+	emit(self.report, ActionUpload, path, reason, err)
+
+	return err
+}
+
+func (self *Pusher) upload(ctx context.Context, path string, info fs.FileInfo) error {
+	file, err := os.Open(self.localPath(path))
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	parent, err := self.mkdirAll(ctx, pathlib.Join(self.remotePath, pathlib.Dir(path)))
+	if err != nil {
+		return err
+	}
+
+	writer, err := self.session.FileSystem().Upload(ctx, parent, pathlib.Base(path))
+	if err != nil {
+		return err
+	}
+
+	writer.SetModTime(info.ModTime())
+
+	_, err = writer.ReadFrom(file)
+	if err != nil {
+		_ = writer.Abort()
+		return err
+	}
+
+	link, err := writer.Commit()
+	if err != nil {
+		return err
+	}
+
+	self.state.Records[path] = &record{
+		Size:       info.Size(),
+		ModTime:    info.ModTime().UnixNano(),
+		Hash:       writer.Hash(),
+		LinkID:     link.ID(),
+		RevisionID: link.RevisionID(),
+	}
+
+	self.dirty = true
+
+	// The file was written to while it was uploaded, upload it again once it is stable
+	after, err := file.Stat()
+	if err == nil && (after.Size() != info.Size() || !after.ModTime().Equal(info.ModTime())) {
+		self.pending[path] = time.Now()
+	}
+
+	return nil
+}
+
+// mkdirAll returns the remote folder at an absolute path, creating it and its parents if necessary.
+func (self *Pusher) mkdirAll(ctx context.Context, path string) (*drive.Link, error) {
+	link := self.session.Links().LinkFromPath(path)
+
+	if link == nil {
+		parent, err := self.mkdirAll(ctx, pathlib.Dir(path))
+		if err != nil {
+			return nil, err
+		}
+
+		link, err = self.session.FileSystem().CreateDir(ctx, parent, pathlib.Base(path))
+		if errors.Is(err, drive.ErrAlreadyExists) {
+			link, err = self.session.Links().LinkFromPath(path), nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if link == nil || !link.IsDir() {
+		return nil, fmt.Errorf("%s: not a folder: %w", path, drive.ErrInvalidLinkType)
+	}
+
+	return link, nil
+}
+
+// renamePaths moves the entries for a path and everything below it to a new path.
+func renamePaths[T any](entries map[string]T, oldPath string, newPath string) {
+	renamed := map[string]T{}
+
+	for name, value := range entries {
+		if isBelow(name, oldPath) {
+			delete(entries, name)
+			renamed[newPath+strings.TrimPrefix(name, oldPath)] = value
+		}
+	}
+
+	for name, value := range renamed {
+		entries[name] = value
+	}
+}
@@ -0,0 +1,126 @@
+package foldersync
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	pathlib "path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+// localFile is a file or folder found by scanning the local directory.
+type localFile struct {
+	dir     bool
+	size    int64
+	modTime time.Time
+
+	// Computed on demand, hashing is expensive
+	hash string
+}
+
+func newLocalFile(info fs.FileInfo) *localFile {
+	return &localFile{
+		dir:     info.IsDir(),
+		size:    info.Size(),
+		modTime: info.ModTime(),
+	}
+}
+
+// matches reports whether a file still looks like it did when it was scanned.
+func (self *localFile) matches(info fs.FileInfo) bool {
+	return info.IsDir() == self.dir && (self.dir || info.Size() == self.size && info.ModTime().Equal(self.modTime))
+}
+
+// matchesRecord reports whether a file still looks like it did when it was last synced.
+func (self *localFile) matchesRecord(rec *record) bool {
+	return self.size == rec.Size && self.modTime.UnixNano() == rec.ModTime
+}
+
+// scanLocal returns all files and folders below root, keyed by their slash separated path relative to root.
+// Symlinks and other special files are skipped.
+func scanLocal(root string) (map[string]*localFile, error) {
+	out := map[string]*localFile{}
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path == root {
+			return nil
+		}
+
+		if strings.HasPrefix(entry.Name(), internalPrefix) {
+			return nil
+		}
+
+		if !entry.IsDir() && !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		out[filepath.ToSlash(rel)] = newLocalFile(info)
+		return nil
+	})
+
+	return out, err
+}
+
+// scanRemote returns all links below root, keyed by their path relative to root.
+func scanRemote(root *drive.Link) map[string]*drive.Link {
+	out := map[string]*drive.Link{}
+
+	var walk func(link *drive.Link, prefix string)
+	walk = func(link *drive.Link, prefix string) {
+		for child := range link.Children().Iter() {
+			if strings.HasPrefix(child.Name(), internalPrefix) {
+				continue
+			}
+
+			path := pathlib.Join(prefix, child.Name())
+			out[path] = child
+
+			if child.IsDir() {
+				walk(child, path)
+			}
+		}
+	}
+
+	walk(root, "")
+	return out
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	hash := sha1.New()
+
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,98 @@
+package foldersync
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+const (
+	stateVersion = 1
+
+	// Files with this prefix are owned by the sync engine and never synced
+	internalPrefix = ".proton-sync"
+
+	DefaultStateName = internalPrefix + "-state.json"
+)
+
+var (
+	ErrStateVersion = errors.New("unsupported state version")
+)
+
+// record is the state of a path after it was last synced, when both sides were known to be identical.
+type record struct {
+	Dir bool `json:"dir,omitempty"`
+
+	// Local side
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"`
+	Hash    string `json:"sha1,omitempty"`
+
+	// Remote side
+	LinkID     string `json:"link_id"`
+	RevisionID string `json:"revision_id,omitempty"`
+}
+
+type state struct {
+	Version int                `json:"version"`
+	Records map[string]*record `json:"records"`
+}
+
+func loadState(path string) (*state, error) {
+	out := &state{Version: stateVersion, Records: map[string]*record{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return out, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, out)
+	if err != nil {
+		return nil, err
+	}
+
+	if out.Version != stateVersion {
+		return nil, ErrStateVersion
+	}
+
+	if out.Records == nil {
+		out.Records = map[string]*record{}
+	}
+
+	return out, nil
+}
+
+// save writes the state to a temporary file first, so a crash can't leave a truncated database behind.
+func (self *state) save(path string) error {
+	data, err := json.Marshal(self)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), internalPrefix+"-*.tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
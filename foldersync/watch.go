@@ -0,0 +1,34 @@
+package foldersync
+
+import (
+	"errors"
+)
+
+var (
+	ErrWatchUnsupported = errors.New("watching folders is not supported on this platform")
+	ErrRootRemoved      = errors.New("watched folder was removed")
+)
+
+type watchOp int
+
+const (
+	// A file was written or created, or a folder was created or moved into the tree
+	watchChange watchOp = iota
+
+	// A file or folder was removed or moved out of the tree
+	watchRemove
+
+	// A file or folder was moved within the tree
+	watchRename
+
+	// Events were lost and the whole tree has to be scanned again
+	watchRescan
+)
+
+// watchEvent is a change below the watched folder. Paths are slash separated and relative to the folder.
+type watchEvent struct {
+	op      watchOp
+	path    string
+	oldPath string
+	dir     bool
+}
@@ -0,0 +1,292 @@
+//go:build linux
+
+package foldersync
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"os"
+	pathlib "path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const watchMask = unix.IN_CREATE | unix.IN_MODIFY | unix.IN_CLOSE_WRITE |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE | unix.IN_DELETE_SELF | unix.IN_MOVE_SELF |
+	unix.IN_ONLYDIR | unix.IN_DONT_FOLLOW | unix.IN_EXCL_UNLINK
+
+// watcher reports changes below a folder using inotify. Inotify only watches single folders, so every folder in the
+// tree gets its own watch, and new folders are added as they appear.
+type watcher struct {
+	root string
+	fd   int
+	file *os.File
+
+	paths   map[int32]string
+	watches map[string]int32
+
+	// A move out of a folder, waiting for the matching move into another one
+	moveFrom   *watchEvent
+	moveCookie uint32
+
+	events chan watchEvent
+	err    error
+}
+
+func newWatcher(root string) (*watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	self := &watcher{
+		root:    root,
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		paths:   map[int32]string{},
+		watches: map[string]int32{},
+		events:  make(chan watchEvent, 1024),
+	}
+
+	err = self.addRecursive("")
+	if err != nil {
+		_ = self.file.Close()
+		return nil, err
+	}
+
+	go self.read()
+	return self, nil
+}
+
+// Events returns the channel of changes. It is closed when the watcher stops, Err then returns the reason.
+func (self *watcher) Events() <-chan watchEvent {
+	return self.events
+}
+
+func (self *watcher) Err() error {
+	return self.err
+}
+
+func (self *watcher) Close() error {
+	return self.file.Close()
+}
+
+func (self *watcher) addRecursive(path string) error {
+	return filepath.WalkDir(filepath.Join(self.root, filepath.FromSlash(path)), func(
+		name string,
+		entry fs.DirEntry,
+		err error,
+	) error {
+		// Folders can disappear while they are being walked, the removal shows up as an event
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !entry.IsDir() {
+			return nil
+		}
+
+		if strings.HasPrefix(entry.Name(), internalPrefix) {
+			return fs.SkipDir
+		}
+
+		rel, err := filepath.Rel(self.root, name)
+		if err != nil {
+			return err
+		}
+
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			rel = ""
+		}
+
+		wd, err := unix.InotifyAddWatch(self.fd, name, watchMask)
+		if errors.Is(err, unix.ENOENT) || errors.Is(err, unix.ENOTDIR) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// Adding the same folder twice returns the existing watch
+		delete(self.watches, self.paths[int32(wd)])
+
+		self.paths[int32(wd)] = rel
+		self.watches[rel] = int32(wd)
+
+		return nil
+	})
+}
+
+func (self *watcher) removeRecursive(path string) {
+	for name, wd := range self.watches {
+		if name != path && !strings.HasPrefix(name, path+"/") {
+			continue
+		}
+
+		_, _ = unix.InotifyRmWatch(self.fd, uint32(wd))
+
+		delete(self.watches, name)
+		delete(self.paths, wd)
+	}
+}
+
+func (self *watcher) renameRecursive(oldPath string, newPath string) {
+	for name, wd := range self.watches {
+		if name != oldPath && !strings.HasPrefix(name, oldPath+"/") {
+			continue
+		}
+
+		renamed := newPath + strings.TrimPrefix(name, oldPath)
+
+		delete(self.watches, name)
+
+		self.watches[renamed] = wd
+		self.paths[wd] = renamed
+	}
+}
+
+func (self *watcher) read() {
+	defer close(self.events)
+
+	buffer := make([]byte, 64*1024)
+
+	for {
+		n, err := self.file.Read(buffer)
+		if errors.Is(err, os.ErrClosed) {
+			return
+		}
+
+		if err != nil {
+			self.err = err
+			return
+		}
+
+		err = self.parse(buffer[:n])
+		if err != nil {
+			self.err = err
+			return
+		}
+	}
+}
+
+func (self *watcher) parse(buffer []byte) error {
+	for len(buffer) >= unix.SizeofInotifyEvent {
+		event := unix.InotifyEvent{
+			Wd:     int32(binary.NativeEndian.Uint32(buffer[0:])),
+			Mask:   binary.NativeEndian.Uint32(buffer[4:]),
+			Cookie: binary.NativeEndian.Uint32(buffer[8:]),
+			Len:    binary.NativeEndian.Uint32(buffer[12:]),
+		}
+
+		end := unix.SizeofInotifyEvent + int(event.Len)
+		name := string(bytes.TrimRight(buffer[unix.SizeofInotifyEvent:end], "\x00"))
+		buffer = buffer[end:]
+
+		err := self.handle(&event, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Moves are reported as a pair of events that arrive together. A move whose counterpart is missing crossed the
+	// border of the tree.
+	self.flushMove()
+	return nil
+}
+
+func (self *watcher) handle(event *unix.InotifyEvent, name string) error {
+	// Anything but the matching move into another folder completes a pending move out of the tree
+	if event.Mask&unix.IN_MOVED_TO == 0 || event.Cookie != self.moveCookie {
+		self.flushMove()
+	}
+
+	if event.Mask&unix.IN_Q_OVERFLOW != 0 {
+		self.events <- watchEvent{op: watchRescan}
+		return nil
+	}
+
+	dir, ok := self.paths[event.Wd]
+
+	if event.Mask&unix.IN_IGNORED != 0 {
+		if ok && self.watches[dir] == event.Wd {
+			delete(self.watches, dir)
+		}
+
+		delete(self.paths, event.Wd)
+		return nil
+	}
+
+	if !ok {
+		return nil
+	}
+
+	if event.Mask&(unix.IN_DELETE_SELF|unix.IN_MOVE_SELF) != 0 {
+		if dir == "" {
+			return ErrRootRemoved
+		}
+
+		// Handled through the event of the parent folder
+		return nil
+	}
+
+	if name == "" || strings.HasPrefix(name, internalPrefix) {
+		return nil
+	}
+
+	path := pathlib.Join(dir, name)
+	isDir := event.Mask&unix.IN_ISDIR != 0
+
+	if event.Mask&unix.IN_MOVED_TO != 0 && self.moveFrom != nil && self.moveCookie == event.Cookie {
+		oldPath := self.moveFrom.path
+		self.moveFrom = nil
+
+		if isDir {
+			self.renameRecursive(oldPath, path)
+		}
+
+		self.events <- watchEvent{op: watchRename, path: path, oldPath: oldPath, dir: isDir}
+		return nil
+	}
+
+	switch {
+	case event.Mask&unix.IN_MOVED_FROM != 0:
+		self.moveFrom = &watchEvent{op: watchRemove, path: path, dir: isDir}
+		self.moveCookie = event.Cookie
+	case event.Mask&unix.IN_DELETE != 0:
+		self.events <- watchEvent{op: watchRemove, path: path, dir: isDir}
+	case isDir && event.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0:
+		err := self.addRecursive(path)
+		if err != nil {
+			return err
+		}
+
+		self.events <- watchEvent{op: watchChange, path: path, dir: true}
+	case !isDir:
+		self.events <- watchEvent{op: watchChange, path: path}
+	}
+
+	return nil
+}
+
+func (self *watcher) flushMove() {
+	if self.moveFrom == nil {
+		return
+	}
+
+	if self.moveFrom.dir {
+		self.removeRecursive(self.moveFrom.path)
+	}
+
+	self.events <- *self.moveFrom
+	self.moveFrom = nil
+}
@@ -0,0 +1,202 @@
+//go:build linux
+
+package foldersync
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func inotifyEvent(wd int32, mask uint32, cookie uint32, name string) []byte {
+	length := 0
+	if name != "" {
+		// The kernel pads names with zeros to the next multiple of the event size
+		length = (len(name)/unix.SizeofInotifyEvent + 1) * unix.SizeofInotifyEvent
+	}
+
+	buffer := make([]byte, unix.SizeofInotifyEvent+length)
+
+	binary.NativeEndian.PutUint32(buffer[0:], uint32(wd))
+	binary.NativeEndian.PutUint32(buffer[4:], mask)
+	binary.NativeEndian.PutUint32(buffer[8:], cookie)
+	binary.NativeEndian.PutUint32(buffer[12:], uint32(length))
+
+	copy(buffer[unix.SizeofInotifyEvent:], name)
+	return buffer
+}
+
+func testWatcher() *watcher {
+	return &watcher{
+		fd:      -1,
+		paths:   map[int32]string{1: "", 2: "docs", 3: "docs/old"},
+		watches: map[string]int32{"": 1, "docs": 2, "docs/old": 3},
+		events:  make(chan watchEvent, 16),
+	}
+}
+
+func drainEvents(self *watcher) []watchEvent {
+	events := []watchEvent{}
+
+	for {
+		select {
+		case event := <-self.events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestWatcherParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		buffer   [][]byte
+		expected []watchEvent
+	}{
+		{
+			name:     "write",
+			buffer:   [][]byte{inotifyEvent(2, unix.IN_CLOSE_WRITE, 0, "a.txt")},
+			expected: []watchEvent{{op: watchChange, path: "docs/a.txt"}},
+		},
+		{
+			name:     "delete",
+			buffer:   [][]byte{inotifyEvent(1, unix.IN_DELETE, 0, "b.txt")},
+			expected: []watchEvent{{op: watchRemove, path: "b.txt"}},
+		},
+		{
+			name: "rename",
+			buffer: [][]byte{
+				inotifyEvent(1, unix.IN_MOVED_FROM, 7, "c.txt"),
+				inotifyEvent(2, unix.IN_MOVED_TO, 7, "d.txt"),
+			},
+			expected: []watchEvent{{op: watchRename, path: "docs/d.txt", oldPath: "c.txt"}},
+		},
+		{
+			name:     "move out of the tree",
+			buffer:   [][]byte{inotifyEvent(2, unix.IN_MOVED_FROM, 8, "e.txt")},
+			expected: []watchEvent{{op: watchRemove, path: "docs/e.txt"}},
+		},
+		{
+			name: "unrelated move",
+			buffer: [][]byte{
+				inotifyEvent(1, unix.IN_MOVED_FROM, 9, "f.txt"),
+				inotifyEvent(1, unix.IN_MOVED_TO, 10, "g.txt"),
+			},
+			expected: []watchEvent{
+				{op: watchRemove, path: "f.txt"},
+				{op: watchChange, path: "g.txt"},
+			},
+		},
+		{
+			name:     "internal files",
+			buffer:   [][]byte{inotifyEvent(1, unix.IN_CLOSE_WRITE, 0, internalPrefix+"state")},
+			expected: []watchEvent{},
+		},
+		{
+			name:     "unknown watch",
+			buffer:   [][]byte{inotifyEvent(42, unix.IN_CLOSE_WRITE, 0, "h.txt")},
+			expected: []watchEvent{},
+		},
+		{
+			name:     "overflow",
+			buffer:   [][]byte{inotifyEvent(-1, unix.IN_Q_OVERFLOW, 0, "")},
+			expected: []watchEvent{{op: watchRescan}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			self := testWatcher()
+
+			buffer := []byte{}
+			for _, event := range test.buffer {
+				buffer = append(buffer, event...)
+			}
+
+			err := self.parse(buffer)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			events := drainEvents(self)
+			if len(events) != len(test.expected) {
+				t.Fatalf("got %v, want %v", events, test.expected)
+			}
+
+			for i := range events {
+				if events[i] != test.expected[i] {
+					t.Errorf("event %d: got %v, want %v", i, events[i], test.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWatcherRenameDir(t *testing.T) {
+	self := testWatcher()
+
+	buffer := append(
+		inotifyEvent(1, unix.IN_MOVED_FROM|unix.IN_ISDIR, 3, "docs"),
+		inotifyEvent(1, unix.IN_MOVED_TO|unix.IN_ISDIR, 3, "papers")...,
+	)
+
+	err := self.parse(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if self.paths[2] != "papers" || self.paths[3] != "papers/old" {
+		t.Errorf("watches were not renamed: %v", self.paths)
+	}
+
+	if _, ok := self.watches["docs"]; ok {
+		t.Errorf("old watch is still known: %v", self.watches)
+	}
+}
+
+func TestWatcherMoveDirOut(t *testing.T) {
+	self := testWatcher()
+
+	err := self.parse(inotifyEvent(1, unix.IN_MOVED_FROM|unix.IN_ISDIR, 4, "docs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(self.watches) != 1 || len(self.paths) != 1 {
+		t.Errorf("watches below the moved folder were kept: %v", self.watches)
+	}
+
+	events := drainEvents(self)
+	if len(events) != 1 || events[0] != (watchEvent{op: watchRemove, path: "docs", dir: true}) {
+		t.Errorf("got %v", events)
+	}
+}
+
+func TestWatcherIgnored(t *testing.T) {
+	self := testWatcher()
+
+	err := self.parse(inotifyEvent(3, unix.IN_IGNORED, 0, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := self.paths[3]; ok {
+		t.Errorf("ignored watch is still known: %v", self.paths)
+	}
+
+	if _, ok := self.watches["docs/old"]; ok {
+		t.Errorf("ignored watch is still known: %v", self.watches)
+	}
+}
+
+func TestWatcherRootRemoved(t *testing.T) {
+	self := testWatcher()
+
+	err := self.parse(inotifyEvent(1, unix.IN_DELETE_SELF, 0, ""))
+	if !errors.Is(err, ErrRootRemoved) {
+		t.Errorf("got %v, want %v", err, ErrRootRemoved)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package foldersync
+
+type watcher struct {
+	events chan watchEvent
+}
+
+func newWatcher(root string) (*watcher, error) {
+	return nil, ErrWatchUnsupported
+}
+
+func (self *watcher) Events() <-chan watchEvent {
+	return self.events
+}
+
+func (self *watcher) Err() error {
+	return nil
+}
+
+func (self *watcher) Close() error {
+	return nil
+}
@@ -9,7 +9,13 @@ require (
 	github.com/barweiss/go-tuple v1.1.2
 	github.com/deckarep/golang-set/v2 v2.6.0
 	github.com/henrybear327/go-proton-api v1.0.0
+	github.com/hugelgupf/p9 v0.3.0
+	github.com/pkg/sftp v1.13.6
 	github.com/relvacode/iso8601 v1.4.0
+	golang.org/x/crypto v0.22.0
+	golang.org/x/net v0.24.0
+	golang.org/x/sys v0.19.0
+	golang.org/x/term v0.19.0
 	golang.org/x/time v0.5.0
 )
 
@@ -28,13 +34,12 @@ require (
 	github.com/emersion/go-vcard v0.0.0-20230815062825-8fda7d206ec9 // indirect
 	github.com/go-resty/resty/v2 v2.12.0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
+	github.com/kr/fs v0.1.0 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/sirupsen/logrus v1.9.3 // indirect
-	golang.org/x/crypto v0.22.0 // indirect
+	github.com/u-root/uio v0.0.0-20230305220412-3e8cd9d6bf63 // indirect
 	golang.org/x/exp v0.0.0-20240416160154-fe59bbe5cc7f // indirect
-	golang.org/x/net v0.24.0 // indirect
 	golang.org/x/sync v0.7.0 // indirect
-	golang.org/x/sys v0.19.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 )
 
@@ -0,0 +1,177 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+var (
+	ErrInvalidSignaturePolicy = errors.New("invalid signature policy")
+)
+
+const (
+	DefaultAppVersion = "macos-drive@1.0.0-alpha.1+proton-drive"
+)
+
+// Config holds the settings shared by the command line tools.
+type Config struct {
+	Dir        string
+	AppVersion string
+
+	// Where the roots of other shares are shown. They are hidden by default.
+	DevicesPath string
+	VolumesPath string
+	SharedPath  string
+	PhotosPath  string
+
+	// What to do with links whose signatures can't be verified: reject, warn or accept
+	Signatures string
+}
+
+// Register adds the shared flags to a flag set.
+func (self *Config) Register(flags *flag.FlagSet) {
+	dir, err := os.UserConfigDir()
+	if err == nil {
+		dir = filepath.Join(dir, "proton-drive")
+	}
+
+	flags.StringVar(&self.Dir, "config", dir, "directory where the session tokens are stored")
+	flags.StringVar(&self.AppVersion, "app-version", DefaultAppVersion, "app version reported to the API")
+	flags.StringVar(&self.DevicesPath, "devices-path", "", "folder for device shares, hidden if empty")
+	flags.StringVar(&self.VolumesPath, "volumes-path", "", "folder for additional volumes, hidden if empty")
+	flags.StringVar(&self.SharedPath, "shared-path", "", "folder for shares of other users, hidden if empty")
+	flags.StringVar(&self.PhotosPath, "photos-path", "", "folder for the photos stream, hidden if empty")
+	flags.StringVar(&self.Signatures, "signatures", "reject", "unverifiable link signatures: reject, warn or accept")
+}
+
+func (self *Config) tokensPath() string {
+	return filepath.Join(self.Dir, "tokens.json")
+}
+
+// SocketPath returns the default location of the drived socket.
+func (self *Config) SocketPath() string {
+	return filepath.Join(self.Dir, "drived.sock")
+}
+
+func (self *Config) loadTokens() (*drive.Tokens, error) {
+	data, err := os.ReadFile(self.tokensPath())
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := &drive.Tokens{}
+
+	err = json.Unmarshal(data, tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (self *Config) saveTokens(tokens *drive.Tokens) error {
+	err := os.MkdirAll(self.Dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(self.tokensPath(), data, 0600)
+}
+
+// Credentials reads login credentials from the environment.
+func (self *Config) Credentials() drive.Credentials {
+	return drive.Credentials{
+		Username:        os.Getenv("PROTON_USERNAME"),
+		Password:        os.Getenv("PROTON_PASSWORD"),
+		TwoFA:           os.Getenv("PROTON_2FA"),
+		MailboxPassword: os.Getenv("PROTON_MAILBOX_PASSWORD"),
+	}
+}
+
+// Login logs in with the given credentials and replaces the stored tokens.
+func (self *Config) Login(ctx context.Context, credentials drive.Credentials) error {
+	application := drive.NewApplication(self.AppVersion)
+
+	err := application.LoginWithCredentials(ctx, credentials)
+	if err != nil {
+		return err
+	}
+
+	return self.saveTokens(application.Tokens())
+}
+
+var signaturePolicies = map[string]drive.SignaturePolicy{
+	"reject": drive.SignatureReject,
+	"warn":   drive.SignatureWarn,
+	"accept": drive.SignatureAccept,
+}
+
+// OpenSession logs in using the stored tokens, or the credentials from the environment if there are none, and
+// loads the link tree.
+func (self *Config) OpenSession(ctx context.Context) (*drive.Session, error) {
+	policy, ok := signaturePolicies[self.Signatures]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidSignaturePolicy, self.Signatures)
+	}
+
+	application := drive.NewApplication(self.AppVersion)
+
+	tokens, err := self.loadTokens()
+	if errors.Is(err, os.ErrNotExist) {
+		err = application.LoginWithCredentials(ctx, self.Credentials())
+		if err != nil {
+			return nil, err
+		}
+
+		err = self.saveTokens(application.Tokens())
+	} else if err == nil {
+		application.LoginWithTokens(tokens)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	application.OnTokensUpdated(func(tokens *drive.Tokens) {
+		_ = self.saveTokens(tokens)
+	})
+
+	session := drive.NewSession(application)
+	session.Links().SetSignaturePolicy(policy)
+
+	if self.DevicesPath != "" || self.VolumesPath != "" || self.SharedPath != "" || self.PhotosPath != "" {
+		session.Links().SetMount(drive.MountUnder(self.DevicesPath, self.VolumesPath, self.SharedPath, self.PhotosPath))
+	}
+
+	session.Links().OnSignatureError(func(link *drive.Link, err error) {
+		fmt.Fprintf(os.Stderr, "warning: %s: %v\n", link.Path(), err)
+	})
+
+	session.Links().OnShareError(func(share *drive.Share, err error) {
+		name := share.Name()
+		if name == "" {
+			name = share.ID()
+		}
+
+		fmt.Fprintf(os.Stderr, "warning: share %s: %v\n", name, err)
+	})
+
+	err = session.Init(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
@@ -0,0 +1,25 @@
+package httpauth
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// Basic wraps a handler so that requests have to authenticate with the given username and password using HTTP basic
+// authentication. Both are compared in constant time.
+func Basic(handler http.Handler, username string, password string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+
+		userOK := subtle.ConstantTimeCompare([]byte(user), []byte(username)) == 1
+		passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(password)) == 1
+
+		if !ok || !userOK || !passOK {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Proton Drive"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,43 @@
+package httpauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBasic(t *testing.T) {
+	handler := Basic(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}), "user", "secret")
+
+	tests := []struct {
+		name     string
+		user     string
+		pass     string
+		expected int
+	}{
+		{"valid", "user", "secret", http.StatusNoContent},
+		{"wrong password", "user", "wrong", http.StatusUnauthorized},
+		{"wrong user", "other", "secret", http.StatusUnauthorized},
+		{"missing", "", "", http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.user != "" {
+			r.SetBasicAuth(test.user, test.pass)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expected {
+			t.Errorf("%s: got status %d, want %d", test.name, w.Code, test.expected)
+		}
+
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: no authentication challenge", test.name)
+		}
+	}
+}
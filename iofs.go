@@ -0,0 +1,220 @@
+package drive
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	pathlib "path"
+	"sort"
+)
+
+var _ fs.FS = &FS{}
+var _ fs.ReadDirFS = &FS{}
+var _ fs.StatFS = &FS{}
+var _ fs.ReadFileFS = &FS{}
+
+// FS exposes the link tree as a read-only io/fs file system.
+type FS struct {
+	//
+	// PARAMETERS
+	//
+
+	ctx context.Context
+
+	links *Links
+	fs    *FileSystem
+}
+
+func (self *FS) link(op string, name string) (*Link, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	link := self.links.LinkFromPath(pathlib.Join("/", name))
+	if link == nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+
+	return link, nil
+}
+
+func (self *FS) Open(name string) (fs.File, error) {
+	link, err := self.link("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fsFile{fsys: self, name: name, link: link}, nil
+}
+
+func (self *FS) Stat(name string) (fs.FileInfo, error) {
+	link, err := self.link("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return linkInfo(link), nil
+}
+
+func (self *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	link, err := self.link("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !link.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: ErrInvalidLinkType}
+	}
+
+	return sortedEntries(link), nil
+}
+
+func (self *FS) ReadFile(name string) ([]byte, error) {
+	link, err := self.link("read", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !link.IsFile() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: ErrInvalidLinkType}
+	}
+
+	reader, err := self.fs.Download(self.ctx, link)
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	return io.ReadAll(reader)
+}
+
+func sortedEntries(link *Link) []fs.DirEntry {
+	children := link.Children().ToSlice()
+
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Name() < children[j].Name()
+	})
+
+	entries := make([]fs.DirEntry, len(children))
+	for i, child := range children {
+		entries[i] = child
+	}
+
+	return entries
+}
+
+// linkInfo returns the fs.FileInfo of a link, making sure that the root is called "." like io/fs expects.
+func linkInfo(link *Link) fs.FileInfo {
+	if link.IsRoot() {
+		return &rootInfo{Link: link}
+	}
+
+	return link
+}
+
+type rootInfo struct {
+	*Link
+}
+
+func (self *rootInfo) Name() string {
+	return "."
+}
+
+var _ fs.ReadDirFile = &fsFile{}
+var _ io.Seeker = &fsFile{}
+
+type fsFile struct {
+	//
+	// PARAMETERS
+	//
+
+	fsys *FS
+	name string
+	link *Link
+
+	//
+	// INTERNAL STATE
+	//
+
+	reader  *FileReader
+	entries []fs.DirEntry
+}
+
+func (self *fsFile) Stat() (fs.FileInfo, error) {
+	return linkInfo(self.link), nil
+}
+
+func (self *fsFile) open() error {
+	if self.reader != nil {
+		return nil
+	}
+
+	if !self.link.IsFile() {
+		return &fs.PathError{Op: "read", Path: self.name, Err: ErrInvalidLinkType}
+	}
+
+	reader, err := self.fsys.fs.Download(self.fsys.ctx, self.link)
+	if err != nil {
+		return &fs.PathError{Op: "read", Path: self.name, Err: err}
+	}
+
+	self.reader = reader
+	return nil
+}
+
+func (self *fsFile) Read(buffer []byte) (int, error) {
+	err := self.open()
+	if err != nil {
+		return 0, err
+	}
+
+	return self.reader.Read(buffer)
+}
+
+func (self *fsFile) Seek(offset int64, whence int) (int64, error) {
+	err := self.open()
+	if err != nil {
+		return 0, err
+	}
+
+	return self.reader.Seek(offset, whence)
+}
+
+func (self *fsFile) ReadDir(count int) ([]fs.DirEntry, error) {
+	if !self.link.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: self.name, Err: ErrInvalidLinkType}
+	}
+
+	if self.entries == nil {
+		self.entries = sortedEntries(self.link)
+	}
+
+	if count <= 0 {
+		entries := self.entries
+		self.entries = []fs.DirEntry{}
+
+		return entries, nil
+	}
+
+	if len(self.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	count = min(count, len(self.entries))
+
+	entries := self.entries[:count]
+	self.entries = self.entries[count:]
+
+	return entries, nil
+}
+
+func (self *fsFile) Close() error {
+	if self.reader == nil {
+		return nil
+	}
+
+	return self.reader.Close()
+}
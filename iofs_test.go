@@ -0,0 +1,109 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+func testFS(t *testing.T) *FS {
+	links := testLinks()
+
+	documents := testLink(links.share, "documents", "Documents", links.root)
+	testLink(links.share, "work", "Work", documents)
+	testLink(links.share, "archive", "Archive", documents)
+	testLink(links.share, "music", "Music", links.root)
+	links.getLinkMaps()
+
+	return &FS{ctx: context.Background(), links: links, fs: testFileSystem(t, links)}
+}
+
+func TestFSNotExist(t *testing.T) {
+	fsys := testFS(t)
+
+	for _, name := range []string{"Missing", "Documents/Missing", "Music/Work"} {
+		_, err := fsys.Stat(name)
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("stat %s: got %v, want %v", name, err, fs.ErrNotExist)
+		}
+
+		_, err = fsys.Open(name)
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("open %s: got %v, want %v", name, err, fs.ErrNotExist)
+		}
+	}
+
+	for _, name := range []string{"/Documents", "Documents/", "./Documents", "Documents/../Music"} {
+		_, err := fsys.Stat(name)
+		if !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("stat %s: got %v, want %v", name, err, fs.ErrInvalid)
+		}
+	}
+}
+
+func TestFSRoot(t *testing.T) {
+	fsys := testFS(t)
+
+	info, err := fsys.Stat(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Name() != "." || !info.IsDir() {
+		t.Errorf("got %q (directory: %t), want %q (directory: true)", info.Name(), info.IsDir(), ".")
+	}
+
+	file, err := fsys.Open(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err = file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Name() != "." {
+		t.Errorf("got %q, want %q", info.Name(), ".")
+	}
+}
+
+func TestFSReadDir(t *testing.T) {
+	fsys := testFS(t)
+
+	tests := []struct {
+		name     string
+		expected []string
+	}{
+		{".", []string{"Documents", "Music"}},
+		{"Documents", []string{"Archive", "Work"}},
+		{"Music", []string{}},
+	}
+
+	for _, test := range tests {
+		entries, err := fsys.ReadDir(test.name)
+		if err != nil {
+			t.Fatalf("readdir %s: %v", test.name, err)
+		}
+
+		names := make([]string, len(entries))
+		for i, entry := range entries {
+			names[i] = entry.Name()
+		}
+
+		if !slices.Equal(names, test.expected) {
+			t.Errorf("readdir %s: got %v, want %v", test.name, names, test.expected)
+		}
+	}
+}
+
+func TestFSFolders(t *testing.T) {
+	// Only folders, since reading files would download them
+	err := fstest.TestFS(testFS(t), "Documents", "Documents/Archive", "Documents/Work", "Music")
+	if err != nil {
+		t.Error(err)
+	}
+}
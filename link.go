@@ -1,6 +1,7 @@
 package drive
 
 import (
+	"io/fs"
 	pathlib "path"
 	"time"
 
@@ -27,6 +28,12 @@ type Link struct {
 	sessionKey *crypto.SessionKey
 
 	hashKey []byte
+
+	// Folders that only exist locally, to hold the roots of other shares
+	virtual bool
+
+	// Why the signatures couldn't be verified, if the policy allowed loading the link anyway
+	signatureErr error
 }
 
 func (self *Link) ID() string {
@@ -85,6 +92,27 @@ func (self *Link) IsRoot() bool {
 	return self.parent == nil
 }
 
+// IsVirtual reports whether the link is a folder that only exists locally, to hold the roots of other shares.
+func (self *Link) IsVirtual() bool {
+	return self.virtual
+}
+
+// IsShareRoot reports whether the link is the root of its share. Share roots can't be moved, renamed or deleted.
+func (self *Link) IsShareRoot() bool {
+	return self.share != nil && self.link.LinkID == self.share.LinkID()
+}
+
+// Verified reports whether the signatures of the link were verified. Virtual folders have no signatures, and count
+// as verified.
+func (self *Link) Verified() bool {
+	return self.signatureErr == nil
+}
+
+// SignatureError returns why the signatures of the link couldn't be verified, or nil if they were.
+func (self *Link) SignatureError() error {
+	return self.signatureErr
+}
+
 func (self *Link) Size() int64 {
 	if self.attrs == nil {
 		return self.link.Size
@@ -118,6 +146,10 @@ func (self *Link) MIMEType() string {
 }
 
 func (self *Link) BlockSizes() []int64 {
+	if self.attrs == nil {
+		return nil
+	}
+
 	return self.attrs.BlockSizes
 }
 
@@ -152,3 +184,34 @@ func (self *Link) NodePassphrase() string {
 func (self *Link) NodePassphraseSignature() string {
 	return self.link.NodePassphraseSignature
 }
+
+//
+// fs.FileInfo and fs.DirEntry
+//
+
+var _ fs.FileInfo = &Link{}
+var _ fs.DirEntry = &Link{}
+
+func (self *Link) Mode() fs.FileMode {
+	if self.IsDir() {
+		return fs.ModeDir | 0755
+	}
+
+	return 0644
+}
+
+func (self *Link) ModTime() time.Time {
+	return self.ModificationTime()
+}
+
+func (self *Link) Sys() any {
+	return nil
+}
+
+func (self *Link) Type() fs.FileMode {
+	return self.Mode().Type()
+}
+
+func (self *Link) Info() (fs.FileInfo, error) {
+	return self, nil
+}
@@ -3,9 +3,11 @@ package drive
 import (
 	"context"
 	"errors"
+	"fmt"
 	pathlib "path"
 	"sync"
 
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
 	"github.com/barweiss/go-tuple"
 	mapset "github.com/deckarep/golang-set/v2"
 	"github.com/henrybear327/go-proton-api"
@@ -16,10 +18,29 @@ import (
 var (
 	ErrMainVolumeNotFound             = errors.New("main volume not found")
 	ErrShareAddressNotFound           = errors.New("share address not found")
+	ErrShareCreatorNotFound           = errors.New("share creator not found")
 	ErrLinkSignatureEmailNotFound     = errors.New("signature email not found")
 	ErrLinkNameSignatureEmailNotFound = errors.New("name signature email not found")
 )
 
+type ChangeType int
+
+const (
+	ChangeCreate ChangeType = iota
+	ChangeUpdate
+	ChangeDelete
+)
+
+// Change describes a modification of the link tree. OldPath is only set for updates that moved or renamed the link.
+type Change struct {
+	Type    ChangeType
+	LinkID  string
+	Path    string
+	OldPath string
+}
+
+type ChangeHandler func(Change)
+
 type Links struct {
 	//
 	// PARAMETERS
@@ -36,15 +57,26 @@ type Links struct {
 	share  *Share
 	root   *Link
 
+	shares []*Share
+	mount  MountFunc
+
+	signatures       SignaturePolicy
+	onSignatureError []SignatureHandler
+	onShareError     []ShareErrorHandler
+
 	linkByID   map[string]*Link
 	linkByPath map[string]*Link
 
+	onChange []ChangeHandler
+
 	limiter *rate.Limiter
 	lock    sync.RWMutex
+	update  sync.Mutex
 }
 
 func (self *Links) Init(ctx context.Context) error {
 	self.lock = sync.RWMutex{}
+	self.update = sync.Mutex{}
 
 	err := self.getVolume(ctx)
 	if err != nil {
@@ -61,6 +93,12 @@ func (self *Links) Init(ctx context.Context) error {
 		return err
 	}
 
+	err = self.getShares(ctx)
+	if err != nil {
+		return err
+	}
+
+	self.callOnSignatureErrorRecursive(self.root)
 	return nil
 }
 
@@ -83,28 +121,73 @@ func (self *Links) getVolume(ctx context.Context) error {
 }
 
 func (self *Links) getShare(ctx context.Context) error {
-	share, err := self.client.GetShare(ctx, self.volume.ShareID())
+	share, err := self.loadShare(ctx, self.volume.ShareID())
 	if err != nil {
 		return err
 	}
 
+	self.share = share
+	return nil
+}
+
+func (self *Links) loadShare(ctx context.Context, shareID string) (*Share, error) {
+	share, err := self.client.GetShare(ctx, shareID)
+	if err != nil {
+		return nil, err
+	}
+
 	address := self.user.AddressFromID(share.AddressID)
 	if address == nil {
-		return ErrShareAddressNotFound
+		return nil, ErrShareAddressNotFound
+	}
+
+	out := &Share{
+		share:   share,
+		address: address,
+		foreign: share.Creator != "" && self.user.AddressFromEmail(share.Creator) == nil,
+	}
+
+	if out.foreign {
+		err = self.getForeignShareKeyRing(ctx, out)
+	} else {
+		out.keyring, err = share.GetKeyRing(address.Keyring())
 	}
 
-	keyring, err := share.GetKeyRing(address.Keyring())
 	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// getForeignShareKeyRing decrypts the key of a share that another user created. The passphrase is encrypted to the
+// address of this user, but signed by the creator, so it is verified with their public keys. If the signature can't
+// be verified, the signature policy decides whether the share is loaded anyway.
+func (self *Links) getForeignShareKeyRing(ctx context.Context, share *Share) error {
+	key, passphrase, signature := share.share.Key, share.share.Passphrase, share.share.PassphraseSignature
+
+	creator, err := self.user.PublicAddress(ctx, share.Creator())
+	if err != nil && !errors.Is(err, ErrPublicKeysNotFound) {
 		return err
 	}
 
-	self.share = &Share{
-		share:   share,
-		address: address,
-		keyring: keyring,
+	if err != nil {
+		err = fmt.Errorf("%w %q: %w", ErrShareCreatorNotFound, share.Creator(), err)
+	} else {
+		share.keyring, err = getKeyRing(share.address.Keyring(), creator.Keyring(), key, passphrase, signature)
+		if err == nil {
+			return nil
+		}
 	}
 
-	return nil
+	if self.signatures == SignatureReject {
+		return err
+	}
+
+	share.signatureErr = err
+
+	share.keyring, err = getKeyRing(share.address.Keyring(), nil, key, passphrase, signature)
+	return err
 }
 
 func (self *Links) getRoot(ctx context.Context) error {
@@ -115,7 +198,7 @@ func (self *Links) getRoot(ctx context.Context) error {
 		return err
 	}
 
-	root, err := self.getLinksRecursive(ctx, rootLink, nil)
+	root, err := self.getLinksRecursive(ctx, self.share, rootLink, nil)
 	if err != nil {
 		return err
 	}
@@ -126,8 +209,13 @@ func (self *Links) getRoot(ctx context.Context) error {
 	return nil
 }
 
-func (self *Links) getLinksRecursive(ctx context.Context, link proton.Link, parent *Link) (*Link, error) {
-	out, err := self.getLink(link, parent)
+func (self *Links) getLinksRecursive(
+	ctx context.Context,
+	share *Share,
+	link proton.Link,
+	parent *Link,
+) (*Link, error) {
+	out, err := self.getLink(ctx, link, parent, share)
 	if err != nil {
 		return nil, err
 	}
@@ -141,7 +229,7 @@ func (self *Links) getLinksRecursive(ctx context.Context, link proton.Link, pare
 		return nil, err
 	}
 
-	childLinks, err := self.client.ListChildren(ctx, self.share.ID(), out.ID(), true)
+	childLinks, err := self.client.ListChildren(ctx, share.ID(), out.ID(), true)
 	if err != nil {
 		return nil, err
 	}
@@ -159,7 +247,7 @@ func (self *Links) getLinksRecursive(ctx context.Context, link proton.Link, pare
 		count++
 
 		go func() {
-			channel <- tuple.New2(self.getLinksRecursive(ctx, childLink, out))
+			channel <- tuple.New2(self.getLinksRecursive(ctx, share, childLink, out))
 		}()
 	}
 
@@ -175,33 +263,83 @@ func (self *Links) getLinksRecursive(ctx context.Context, link proton.Link, pare
 	return out, nil
 }
 
-func (self *Links) getLink(link proton.Link, parent *Link) (*Link, error) {
-	signAddress := self.user.AddressFromEmail(link.SignatureEmail)
-	if signAddress == nil {
-		return nil, ErrLinkSignatureEmailNotFound
+// getLink decrypts a link and verifies its signatures. Links signed by other users are verified with their public
+// keys. If the signatures can't be verified, the signature policy decides whether the link is loaded anyway.
+func (self *Links) getLink(ctx context.Context, link proton.Link, parent *Link, share *Share) (*Link, error) {
+	signAddress, signErr := self.user.PublicAddress(ctx, link.SignatureEmail)
+	if signErr != nil && !errors.Is(signErr, ErrPublicKeysNotFound) {
+		return nil, signErr
+	}
+
+	nameSignAddress, nameSignErr := self.user.PublicAddress(ctx, link.NameSignatureEmail)
+	if nameSignErr != nil && !errors.Is(nameSignErr, ErrPublicKeysNotFound) {
+		return nil, nameSignErr
+	}
+
+	if signErr != nil {
+		signErr = fmt.Errorf("%w %q: %w", ErrLinkSignatureEmailNotFound, link.SignatureEmail, signErr)
+	}
+
+	if nameSignErr != nil {
+		nameSignErr = fmt.Errorf("%w %q: %w", ErrLinkNameSignatureEmailNotFound, link.NameSignatureEmail, nameSignErr)
+	}
+
+	err := errors.Join(signErr, nameSignErr)
+
+	if err == nil {
+		var out *Link
+
+		out, err = self.decryptLink(link, parent, share, signAddress, nameSignAddress, true)
+		if err == nil {
+			return out, nil
+		}
 	}
 
-	nameSignAddress := self.user.AddressFromEmail(link.NameSignatureEmail)
-	if nameSignAddress == nil {
-		return nil, ErrLinkNameSignatureEmailNotFound
+	if self.signatures == SignatureReject {
+		return nil, err
 	}
 
-	parentKR := self.share.Keyring()
-	if parent != nil {
+	out, decErr := self.decryptLink(link, parent, share, signAddress, nameSignAddress, false)
+	if decErr != nil {
+		return nil, decErr
+	}
+
+	out.signatureErr = err
+	return out, nil
+}
+
+func (self *Links) decryptLink(
+	link proton.Link,
+	parent *Link,
+	share *Share,
+	signAddress *Address,
+	nameSignAddress *Address,
+	verify bool,
+) (*Link, error) {
+	parentKR := share.Keyring()
+	if parent != nil && link.LinkID != share.LinkID() {
 		parentKR = parent.Keyring()
 	}
 
-	keyring, err := link.GetKeyRing(parentKR, signAddress.Keyring())
+	// Without keyrings, the signatures are not checked
+	var signKR, nameSignKR *crypto.KeyRing
+
+	if verify {
+		signKR = signAddress.Keyring()
+		nameSignKR = nameSignAddress.Keyring()
+	}
+
+	keyring, err := getKeyRing(parentKR, signKR, link.NodeKey, link.NodePassphrase, link.NodePassphraseSignature)
 	if err != nil {
 		return nil, err
 	}
 
-	name, err := link.GetName(parentKR, nameSignAddress.Keyring())
+	name, err := link.GetName(parentKR, nameSignKR)
 	if err != nil {
 		return nil, err
 	}
 
-	xAttrs, err := link.GetDecXAttrString(signAddress.Keyring(), keyring)
+	xAttrs, err := link.GetDecXAttrString(signKR, keyring)
 	if err != nil {
 		return nil, err
 	}
@@ -210,7 +348,7 @@ func (self *Links) getLink(link proton.Link, parent *Link) (*Link, error) {
 		link: link,
 
 		name:  name,
-		share: self.share,
+		share: share,
 
 		signAddress:     signAddress,
 		nameSignAddress: nameSignAddress,
@@ -232,7 +370,7 @@ func (self *Links) getLink(link proton.Link, parent *Link) (*Link, error) {
 
 		out.sessionKey = sessionKey
 	} else {
-		hashKey, err := link.GetHashKey(keyring, signAddress.Keyring())
+		hashKey, err := link.GetHashKey(keyring, signKR)
 		if err != nil {
 			return nil, err
 		}
@@ -310,73 +448,201 @@ func (self *Links) LinkFromPath(path string) *Link {
 	return nil
 }
 
-func (self *Links) OnEvent(event proton.LinkEvent) error {
-	old := self.LinkFromID(event.Link.LinkID)
+func (self *Links) OnEvent(ctx context.Context, event proton.LinkEvent) error {
+	return self.apply(ctx, event.Link)
+}
+
+// Refresh fetches the current state of a link from the API and merges it into the tree right away, instead of
+// waiting for the event loop to pick it up. The event that arrives later is then applied as a regular update.
+func (self *Links) Refresh(ctx context.Context, share *Share, linkID string) (*Link, error) {
+	link, err := self.client.GetLink(ctx, share.ID(), linkID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = self.apply(ctx, link)
+	if err != nil {
+		return nil, err
+	}
+
+	return self.LinkFromID(linkID), nil
+}
+
+// Forget removes a link from the tree right away, instead of waiting for the event loop to pick it up.
+func (self *Links) Forget(linkID string) {
+	self.update.Lock()
+	defer self.update.Unlock()
+
+	self.delete(linkID)
+}
+
+// OnChange registers a handler that is called after every change to the tree. Handlers are called while the tree is
+// being updated, so they must not block or modify the tree themselves.
+func (self *Links) OnChange(handler ChangeHandler) {
+	self.update.Lock()
+	defer self.update.Unlock()
 
-	if event.Link.State == proton.LinkStateActive {
-		if old == nil {
-			return self.onCreate(event)
-		} else {
-			return self.onUpdate(event)
+	self.onChange = append(self.onChange, handler)
+}
+
+func (self *Links) callOnChange(change Change) {
+	for _, handler := range self.onChange {
+		handler(change)
+	}
+}
+
+func (self *Links) apply(ctx context.Context, link proton.Link) error {
+	self.update.Lock()
+	defer self.update.Unlock()
+
+	old := self.LinkFromID(link.LinkID)
+
+	if link.State != proton.LinkStateActive {
+		self.delete(link.LinkID)
+		return nil
+	}
+
+	if old == nil {
+		moved, err := self.onCreate(ctx, link)
+		if err != nil {
+			return err
 		}
-	} else {
-		if old != nil {
-			self.onDelete(event)
+
+		if moved != nil {
+			self.callOnChange(*moved)
 		}
+
+		created := self.LinkFromID(link.LinkID)
+		if created != nil {
+			self.callOnSignatureError(created)
+			self.callOnChange(Change{Type: ChangeCreate, LinkID: link.LinkID, Path: created.Path()})
+		}
+
+		return nil
+	}
+
+	oldPath := old.Path()
+	oldRevision := old.RevisionID()
+
+	moved, err := self.onUpdate(ctx, link)
+	if err != nil {
+		return err
 	}
 
+	if moved != nil {
+		self.callOnChange(*moved)
+	}
+
+	self.callOnSignatureError(old)
+
+	// Local operations refresh links right away, so the event that follows usually doesn't change anything
+	if old.Path() == oldPath && old.RevisionID() == oldRevision {
+		return nil
+	}
+
+	change := Change{Type: ChangeUpdate, LinkID: link.LinkID, Path: old.Path()}
+	if change.Path != oldPath {
+		change.OldPath = oldPath
+	}
+
+	self.callOnChange(change)
 	return nil
 }
 
-func (self *Links) onCreate(event proton.LinkEvent) error {
-	if event.Link.State != proton.LinkStateActive {
-		return nil
+func (self *Links) delete(linkID string) {
+	old := self.LinkFromID(linkID)
+	if old == nil {
+		return
 	}
 
-	parent := self.LinkFromID(event.Link.ParentLinkID)
+	path := old.Path()
 
-	self.lock.Lock()
-	defer self.lock.Unlock()
+	self.onDelete(linkID)
+	self.callOnChange(Change{Type: ChangeDelete, LinkID: linkID, Path: path})
+}
+
+// onCreate adds a new link to the tree. If a mount had its name, the mount is renamed and its change is returned.
+func (self *Links) onCreate(ctx context.Context, event proton.Link) (*Change, error) {
+	if event.State != proton.LinkStateActive {
+		return nil, nil
+	}
 
-	link, err := self.getLink(event.Link, parent)
+	parent := self.LinkFromID(event.ParentLinkID)
+	if parent == nil || parent.IsVirtual() {
+		return nil, nil
+	}
+
+	link, err := self.getLink(ctx, event, parent, parent.Share())
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	moved := self.makeRoom(parent, link.name)
+
 	parent.children.Add(link)
 
+	if moved != nil {
+		self.getLinkMaps()
+		return moved, nil
+	}
+
 	self.linkByID[link.ID()] = link
 	self.linkByPath[link.Path()] = link
 
-	return nil
+	return nil, nil
 }
 
-func (self *Links) onUpdate(event proton.LinkEvent) error {
-	old := self.LinkFromID(event.Link.LinkID)
+// onUpdate merges a changed link into the tree. If a mount had its new name, the mount is renamed and its change is
+// returned.
+func (self *Links) onUpdate(ctx context.Context, event proton.Link) (*Change, error) {
+	old := self.LinkFromID(event.LinkID)
 
 	oldParent := old.Parent()
-	newParent := self.LinkFromID(event.Link.ParentLinkID)
+	newParent := self.LinkFromID(event.ParentLinkID)
+
+	// Share roots stay where they were mounted
+	if old.IsShareRoot() {
+		newParent = oldParent
+	}
+
+	link, err := self.getLink(ctx, event, newParent, old.Share())
+	if err != nil {
+		return nil, err
+	}
 
 	self.lock.Lock()
 	defer self.lock.Unlock()
 
-	link, err := self.getLink(event.Link, newParent)
-	if err != nil {
-		return err
+	if old.IsShareRoot() {
+		link.name = old.name
+	}
+
+	// Share roots keep their place, other links push mounts out of their way
+	var moved *Change
+	if newParent != nil && !old.IsShareRoot() {
+		moved = self.makeRoom(newParent, link.name)
 	}
 
 	link.children = old.children
 	*old = *link
 
-	oldParent.children.Remove(old)
-	newParent.children.Add(old)
+	if oldParent != nil {
+		oldParent.children.Remove(old)
+	}
+
+	if newParent != nil {
+		newParent.children.Add(old)
+	}
 
 	self.getLinkMaps()
-	return nil
+	return moved, nil
 }
 
-func (self *Links) onDelete(event proton.LinkEvent) {
-	old := self.LinkFromID(event.Link.LinkID)
+func (self *Links) onDelete(linkID string) {
+	old := self.LinkFromID(linkID)
 
 	if old == nil {
 		return
@@ -385,8 +651,10 @@ func (self *Links) onDelete(event proton.LinkEvent) {
 	self.lock.Lock()
 	defer self.lock.Unlock()
 
-	delete(self.linkByID, old.ID())
-	delete(self.linkByPath, old.Path())
+	if old.Parent() != nil {
+		old.Parent().children.Remove(old)
+	}
 
-	old.Parent().children.Remove(old)
+	// Rebuild the maps so that children of deleted folders are removed too
+	self.getLinkMaps()
 }
@@ -0,0 +1,121 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/henrybear327/go-proton-api"
+)
+
+func testAddress(t *testing.T, email string) *Address {
+	key, err := crypto.GenerateKey(email, email, "x25519", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring, err := crypto.NewKeyRing(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Address{address: proton.Address{Email: email}, keyring: keyring}
+}
+
+// testForeignShare returns a share that creator shared with address, with its passphrase signed by signer.
+func testForeignShare(t *testing.T, address *Address, creator *Address, signer *Address) *Share {
+	key, passphrase, signature, err := generateNodeKeys(address.Keyring(), signer.Keyring())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	share := &Share{address: address, foreign: true}
+
+	share.share.Creator = creator.Email()
+	share.share.Key = key
+	share.share.Passphrase = passphrase
+	share.share.PassphraseSignature = signature
+
+	return share
+}
+
+func testForeignLinks(address *Address, creator *Address) *Links {
+	user := &User{
+		addressByEmail:  map[string]*Address{address.Email(): address},
+		publicAddresses: map[string]*Address{creator.Email(): creator},
+	}
+
+	return &Links{user: user}
+}
+
+func TestForeignShareKeyRing(t *testing.T) {
+	address := testAddress(t, "me@example.com")
+	creator := testAddress(t, "owner@example.com")
+
+	self := testForeignLinks(address, creator)
+	share := testForeignShare(t, address, creator, creator)
+
+	err := self.getForeignShareKeyRing(context.Background(), share)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if share.keyring == nil || share.signatureErr != nil {
+		t.Errorf("share wasn't verified: %v", share.signatureErr)
+	}
+}
+
+func TestForeignShareKeyRingInvalid(t *testing.T) {
+	address := testAddress(t, "me@example.com")
+	creator := testAddress(t, "owner@example.com")
+	other := testAddress(t, "other@example.com")
+
+	for _, policy := range []SignaturePolicy{SignatureReject, SignatureWarn, SignatureAccept} {
+		self := testForeignLinks(address, creator)
+		self.signatures = policy
+
+		// Signed by someone other than the creator
+		share := testForeignShare(t, address, creator, other)
+
+		err := self.getForeignShareKeyRing(context.Background(), share)
+
+		if policy == SignatureReject {
+			if err == nil {
+				t.Errorf("policy %d: share was loaded", policy)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("policy %d: %v", policy, err)
+		}
+
+		if share.keyring == nil || share.signatureErr == nil {
+			t.Errorf("policy %d: share wasn't loaded as unverified", policy)
+		}
+	}
+}
+
+func TestForeignShareKeyRingUnknownCreator(t *testing.T) {
+	address := testAddress(t, "me@example.com")
+	creator := testAddress(t, "owner@example.com")
+
+	self := testForeignLinks(address, creator)
+	self.signatures = SignatureWarn
+
+	// The creator has no public keys
+	self.user.publicAddresses[creator.Email()] = nil
+
+	share := testForeignShare(t, address, creator, creator)
+
+	err := self.getForeignShareKeyRing(context.Background(), share)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !errors.Is(share.signatureErr, ErrShareCreatorNotFound) {
+		t.Errorf("got %v, want %v", share.signatureErr, ErrShareCreatorNotFound)
+	}
+}
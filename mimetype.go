@@ -0,0 +1,196 @@
+package drive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"mime"
+	"net/http"
+	pathlib "path"
+	"strings"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+const (
+	MIMETypeDefault = "application/octet-stream"
+
+	// The longest type stored in the mimetype entry of a ZIP based format that is still read
+	maxZIPMIMETypeSize = 128
+)
+
+type magicSignature struct {
+	offset   int
+	magic    []byte
+	mimeType string
+}
+
+// Signatures that http.DetectContentType doesn't know about, or that it reports too generically.
+var magicSignatures = []magicSignature{
+	{0, []byte("7z\xBC\xAF\x27\x1C"), "application/x-7z-compressed"},
+	{0, []byte("\xFD7zXZ\x00"), "application/x-xz"},
+	{0, []byte("BZh"), "application/x-bzip2"},
+	{0, []byte("\x28\xB5\x2F\xFD"), "application/zstd"},
+	{257, []byte("ustar"), "application/x-tar"},
+	{0, []byte("II*\x00"), "image/tiff"},
+	{0, []byte("MM\x00*"), "image/tiff"},
+	{0, []byte("8BPS"), "image/vnd.adobe.photoshop"},
+	{0, []byte("fLaC"), "audio/flac"},
+	{0, []byte("SQLite format 3\x00"), "application/vnd.sqlite3"},
+	{0, []byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1"), "application/x-ole-storage"},
+}
+
+// ISO base media file format brands (the "ftyp" box) that http.DetectContentType doesn't handle.
+var isoBrands = map[string]string{
+	"heic": "image/heic",
+	"heix": "image/heic",
+	"heim": "image/heic",
+	"heis": "image/heic",
+	"mif1": "image/heif",
+	"msf1": "image/heif",
+	"avif": "image/avif",
+	"avis": "image/avif",
+	"qt  ": "video/quicktime",
+	"3gp4": "video/3gpp",
+	"3gp5": "video/3gpp",
+	"3gp6": "video/3gpp",
+	"3g2a": "video/3gpp2",
+	"M4A ": "audio/mp4",
+	"M4V ": "video/x-m4v",
+	"crx ": "image/x-canon-cr3",
+}
+
+// Directories inside of a ZIP archive that identify Office Open XML documents.
+var ooxmlPrefixes = map[string]string{
+	"word/": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"xl/":   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"ppt/":  "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+}
+
+// Sniffed types that only describe a container, where the file extension is likely more precise.
+var genericMIMETypes = mapset.NewSet(
+	"text/plain",
+	"text/xml",
+	"application/octet-stream",
+	"application/zip",
+	"application/x-ole-storage",
+)
+
+// detectMIMEType guesses the MIME type of a file from the first block of its content, and falls back to the
+// extension of its name if the content only gives a generic answer.
+func detectMIMEType(name string, data []byte) string {
+	sniffed := sniffMIMEType(data)
+	if sniffed != "" && !genericMIMETypes.Contains(sniffed) {
+		return sniffed
+	}
+
+	byExtension := stripMIMEParams(mime.TypeByExtension(pathlib.Ext(name)))
+	if byExtension != "" {
+		return byExtension
+	}
+
+	if sniffed != "" {
+		return sniffed
+	}
+
+	return MIMETypeDefault
+}
+
+func sniffMIMEType(data []byte) string {
+	for _, sig := range magicSignatures {
+		end := sig.offset + len(sig.magic)
+
+		if len(data) >= end && bytes.Equal(data[sig.offset:end], sig.magic) {
+			return sig.mimeType
+		}
+	}
+
+	if len(data) >= 12 && bytes.Equal(data[4:8], []byte("ftyp")) {
+		if mimeType, ok := isoBrands[string(data[8:12])]; ok {
+			return mimeType
+		}
+	}
+
+	if len(data) >= 4 && bytes.Equal(data[:4], []byte("\x1A\x45\xDF\xA3")) {
+		if bytes.Contains(data[:min(len(data), 64)], []byte("matroska")) {
+			return "video/x-matroska"
+		}
+	}
+
+	sniffed := stripMIMEParams(http.DetectContentType(data))
+
+	if sniffed == "application/zip" {
+		return sniffZIP(data)
+	}
+
+	return sniffed
+}
+
+// zipMIMEType returns the type stored in the mimetype entry of a ZIP archive, if it is stored uncompressed and is a
+// valid media type.
+func zipMIMEType(method uint16, content []byte, size int) string {
+	if method != 0 || size == 0 || size > maxZIPMIMETypeSize || len(content) != size {
+		return "application/zip"
+	}
+
+	mimeType := strings.TrimSpace(string(content))
+
+	_, _, err := mime.ParseMediaType(mimeType)
+	if err != nil || !strings.Contains(mimeType, "/") {
+		return "application/zip"
+	}
+
+	return mimeType
+}
+
+// sniffZIP looks at the local file headers of a ZIP archive to detect ZIP based document formats.
+func sniffZIP(data []byte) string {
+	for offset := 0; offset+30 <= len(data); {
+		if !bytes.Equal(data[offset:offset+4], []byte("PK\x03\x04")) {
+			next := bytes.Index(data[offset+1:], []byte("PK\x03\x04"))
+			if next == -1 {
+				break
+			}
+
+			offset += next + 1
+			continue
+		}
+
+		method := binary.LittleEndian.Uint16(data[offset+8:])
+		compressedSize := int(binary.LittleEndian.Uint32(data[offset+18:]))
+		nameLength := int(binary.LittleEndian.Uint16(data[offset+26:]))
+		extraLength := int(binary.LittleEndian.Uint16(data[offset+28:]))
+
+		nameStart := offset + 30
+		dataStart := nameStart + nameLength + extraLength
+
+		if dataStart > len(data) {
+			break
+		}
+
+		name := string(data[nameStart : nameStart+nameLength])
+
+		// OpenDocument and EPUB store their type uncompressed in the first entry
+		if name == "mimetype" {
+			return zipMIMEType(method, data[dataStart:min(len(data), dataStart+compressedSize)], compressedSize)
+		}
+
+		for prefix, mimeType := range ooxmlPrefixes {
+			if strings.HasPrefix(name, prefix) {
+				return mimeType
+			}
+		}
+
+		offset = dataStart
+	}
+
+	return "application/zip"
+}
+
+func stripMIMEParams(mimeType string) string {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return mimeType
+	}
+
+	return mediaType
+}
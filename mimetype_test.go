@@ -0,0 +1,71 @@
+package drive
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// zipEntry returns a ZIP local file header followed by the content, with the size as given.
+func zipEntry(name string, method uint16, size int, content string) []byte {
+	header := make([]byte, 30)
+
+	copy(header, "PK\x03\x04")
+	binary.LittleEndian.PutUint16(header[8:], method)
+	binary.LittleEndian.PutUint32(header[18:], uint32(size))
+	binary.LittleEndian.PutUint32(header[22:], uint32(size))
+	binary.LittleEndian.PutUint16(header[26:], uint16(len(name)))
+
+	return append(append(header, name...), content...)
+}
+
+func TestSniffZIP(t *testing.T) {
+	odt := "application/vnd.oasis.opendocument.text"
+	long := "application/" + strings.Repeat("x", maxZIPMIMETypeSize)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"opendocument", zipEntry("mimetype", 0, len(odt), odt), odt},
+		{"compressed", zipEntry("mimetype", 8, 8, "\x4b\x2c\x28\xc8\xc9\x4c\x4e\x2c"), "application/zip"},
+		{"data descriptor", zipEntry("mimetype", 0, 0, odt+"PK\x07\x08"), "application/zip"},
+		{"too long", zipEntry("mimetype", 0, len(long), long), "application/zip"},
+		{"truncated", zipEntry("mimetype", 0, 100, odt), "application/zip"},
+		{"not a type", zipEntry("mimetype", 0, 7, "garbage"), "application/zip"},
+		{"binary", zipEntry("mimetype", 0, 4, "\x00\x01/\x02"), "application/zip"},
+		{
+			"ooxml",
+			zipEntry("word/document.xml", 8, 0, ""),
+			"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		},
+		{"plain", zipEntry("file.txt", 0, 4, "data"), "application/zip"},
+	}
+
+	for _, test := range tests {
+		if mimeType := sniffZIP(test.data); mimeType != test.expected {
+			t.Errorf("%s: got %q, want %q", test.name, mimeType, test.expected)
+		}
+	}
+}
+
+func TestSniffMIMEType(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"7z", []byte("7z\xBC\xAF\x27\x1C\x00\x04"), "application/x-7z-compressed"},
+		{"flac", []byte("fLaC\x00\x00\x00\x22"), "audio/flac"},
+		{"heic", []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00"), "image/heic"},
+		{"png", []byte("\x89PNG\x0D\x0A\x1A\x0A\x00\x00\x00\x0D"), "image/png"},
+		{"text", []byte("hello world"), "text/plain"},
+	}
+
+	for _, test := range tests {
+		if mimeType := sniffMIMEType(test.data); mimeType != test.expected {
+			t.Errorf("%s: got %q, want %q", test.name, mimeType, test.expected)
+		}
+	}
+}
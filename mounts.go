@@ -0,0 +1,239 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pathlib "path"
+
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/henrybear327/go-proton-api"
+)
+
+var (
+	ErrShareSkipped = errors.New("share skipped")
+)
+
+// MountFunc returns the path below the main root where the root of a share is shown. Name is the name of the share
+// root. An empty path skips the share. Without a mount function, only the main share is loaded.
+type MountFunc func(share *Share, name string) string
+
+// MountUnder shows device shares in the devices folder, the main shares of additional volumes in the volumes folder
+// and all other shares in the shared folder. The photos share is shown as the photos folder itself. An empty folder
+// skips those shares.
+func MountUnder(devices string, volumes string, shared string, photos string) MountFunc {
+	return func(share *Share, name string) string {
+		dir := shared
+
+		switch share.Type() {
+		case proton.ShareTypeDevice:
+			dir = devices
+		case proton.ShareTypeMain:
+			dir = volumes
+		case ShareTypePhotos:
+			return photos
+		}
+
+		if dir == "" {
+			return ""
+		}
+
+		return pathlib.Join(dir, name)
+	}
+}
+
+// SetMount makes the roots of other shares part of the tree, at the paths returned by the mount function. It has to be
+// called before Init.
+func (self *Links) SetMount(mount MountFunc) {
+	self.mount = mount
+}
+
+// ShareErrorHandler is called with a share that is missing from the tree or isn't kept up to date, and the reason.
+type ShareErrorHandler func(share *Share, err error)
+
+// OnShareError registers a handler that is called for every share other than the main one that couldn't be loaded
+// during Init, or whose events can't be followed. Those shares are skipped instead of failing the session. Shares
+// that couldn't be loaded at all only have their ID and metadata set.
+func (self *Links) OnShareError(handler ShareErrorHandler) {
+	self.update.Lock()
+	defer self.update.Unlock()
+
+	self.onShareError = append(self.onShareError, handler)
+}
+
+func (self *Links) callOnShareError(share *Share, err error) {
+	for _, handler := range self.onShareError {
+		handler(share, err)
+	}
+}
+
+// Shares returns every share that is part of the tree, starting with the main share.
+func (self *Links) Shares() []*Share {
+	return self.shares
+}
+
+// getShares loads every other share the user can access and mounts its root below the main root. Shares that can't
+// be loaded are skipped and passed to the share error handlers, so a single broken share doesn't make the whole drive
+// unavailable.
+func (self *Links) getShares(ctx context.Context) error {
+	self.shares = []*Share{self.share}
+
+	if self.mount == nil {
+		return nil
+	}
+
+	shares, err := self.client.ListShares(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	for _, metadata := range shares {
+		if metadata.State != proton.ShareStateActive || metadata.ShareID == self.share.ID() {
+			continue
+		}
+
+		// Standard shares on the main volume point into the tree that is already loaded
+		if metadata.Type == proton.ShareTypeStandard && metadata.VolumeID == self.volume.ID() {
+			continue
+		}
+
+		share, root, err := self.getShareRoot(ctx, metadata.ShareID)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err != nil {
+			skipped := &Share{share: proton.Share{ShareMetadata: metadata}}
+			self.callOnShareError(skipped, fmt.Errorf("%w: %w", ErrShareSkipped, err))
+			continue
+		}
+
+		if self.mountShare(share, root) {
+			self.shares = append(self.shares, share)
+		}
+	}
+
+	return nil
+}
+
+func (self *Links) getShareRoot(ctx context.Context, shareID string) (*Share, *Link, error) {
+	share, err := self.loadShare(ctx, shareID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rootLink, err := self.client.GetLink(ctx, share.ID(), share.LinkID())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	root, err := self.getLinksRecursive(ctx, share, rootLink, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The share key protects every link in it, the root reports that it couldn't be verified
+	if share.signatureErr != nil && root.signatureErr == nil {
+		root.signatureErr = share.signatureErr
+	}
+
+	return share, root, nil
+}
+
+// mountShare attaches the root of a share to the tree, at the path returned by the mount function. Names that are
+// already taken by real links are numbered, like "Shared (1)".
+func (self *Links) mountShare(share *Share, root *Link) bool {
+	path := self.mount(share, root.name)
+	if path == "" {
+		return false
+	}
+
+	path = pathlib.Clean("/" + path)
+	if path == "/" {
+		return false
+	}
+
+	parent := self.mountDir(pathlib.Dir(path))
+	name := self.freeName(parent, pathlib.Base(path), nil)
+
+	share.name = root.name
+
+	root.name = name
+	root.parent = parent
+
+	parent.children.Add(root)
+	self.getLinkMapsRecursive(root)
+
+	return true
+}
+
+// mountDir returns the virtual folder at the given path, creating it and its parents as needed.
+func (self *Links) mountDir(path string) *Link {
+	if path == "/" {
+		return self.root
+	}
+
+	parent := self.mountDir(pathlib.Dir(path))
+
+	name := self.freeName(parent, pathlib.Base(path), func(link *Link) bool {
+		return link.IsVirtual()
+	})
+
+	path = pathlib.Join(parent.Path(), name)
+
+	if link := self.linkByPath[path]; link != nil {
+		return link
+	}
+
+	link := &Link{
+		link: proton.Link{
+			LinkID: "virtual:" + path,
+			Type:   proton.LinkTypeFolder,
+			State:  proton.LinkStateActive,
+		},
+
+		name:     name,
+		parent:   parent,
+		children: mapset.NewSet[*Link](),
+		virtual:  true,
+	}
+
+	parent.children.Add(link)
+
+	self.linkByID[link.ID()] = link
+	self.linkByPath[path] = link
+
+	return link
+}
+
+// freeName numbers a name until it isn't taken in the parent folder, or the link that has it is accepted by reuse.
+func (self *Links) freeName(parent *Link, name string, reuse func(*Link) bool) string {
+	for n := 0; ; n++ {
+		candidate := numberedName(name, n)
+
+		link := self.linkByPath[pathlib.Join(parent.Path(), candidate)]
+		if link == nil || reuse != nil && reuse(link) {
+			return candidate
+		}
+	}
+}
+
+// isMount reports whether a link was put into the tree by mountShare, rather than being part of the main share.
+func (self *Links) isMount(link *Link) bool {
+	return link.IsVirtual() || link.IsShareRoot() && link.Share() != self.share
+}
+
+// makeRoom renames the mount with the given name in the parent folder, so that a real link that was created or moved
+// there later can take its place. It returns the change of the mount, or nil if the name wasn't taken by a mount. The
+// caller has to hold the lock and rebuild the maps.
+func (self *Links) makeRoom(parent *Link, name string) *Change {
+	link := self.linkByPath[pathlib.Join(parent.Path(), name)]
+	if link == nil || !self.isMount(link) {
+		return nil
+	}
+
+	oldPath := link.Path()
+	link.name = self.freeName(parent, name, nil)
+
+	return &Change{Type: ChangeUpdate, LinkID: link.ID(), Path: link.Path(), OldPath: oldPath}
+}
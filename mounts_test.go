@@ -0,0 +1,158 @@
+package drive
+
+import (
+	"testing"
+
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/henrybear327/go-proton-api"
+)
+
+func testShare(shareID string, linkID string, shareType proton.ShareType) *Share {
+	share := &Share{}
+
+	share.share.ShareID = shareID
+	share.share.LinkID = linkID
+	share.share.Type = shareType
+
+	return share
+}
+
+func testLink(share *Share, linkID string, name string, parent *Link) *Link {
+	link := &Link{
+		link:     proton.Link{LinkID: linkID, Type: proton.LinkTypeFolder, State: proton.LinkStateActive},
+		name:     name,
+		share:    share,
+		parent:   parent,
+		children: mapset.NewSet[*Link](),
+	}
+
+	if parent != nil {
+		parent.children.Add(link)
+	}
+
+	return link
+}
+
+func testLinks() *Links {
+	share := testShare("main", "root", proton.ShareTypeMain)
+
+	self := &Links{share: share, root: testLink(share, "root", "", nil)}
+	self.getLinkMaps()
+
+	return self
+}
+
+func TestMountUnder(t *testing.T) {
+	mount := MountUnder("/Computers", "", "/Shared", "/Photos")
+
+	tests := []struct {
+		shareType proton.ShareType
+		expected  string
+	}{
+		{proton.ShareTypeDevice, "/Computers/Laptop"},
+		{proton.ShareTypeMain, ""},
+		{proton.ShareTypeStandard, "/Shared/Laptop"},
+		{ShareTypePhotos, "/Photos"},
+	}
+
+	for _, test := range tests {
+		path := mount(testShare("share", "link", test.shareType), "Laptop")
+		if path != test.expected {
+			t.Errorf("share type %d: got %q, want %q", test.shareType, path, test.expected)
+		}
+	}
+}
+
+func TestMountShare(t *testing.T) {
+	self := testLinks()
+	self.mount = MountUnder("/Computers", "", "", "")
+
+	// A real folder that has the name of the devices folder
+	testLink(self.share, "real", "Computers", self.root)
+	self.getLinkMaps()
+
+	// Two devices with the same name
+	for _, id := range []string{"first", "second"} {
+		share := testShare(id, id+"-root", proton.ShareTypeDevice)
+		root := testLink(share, id+"-root", "Laptop", nil)
+
+		if !self.mountShare(share, root) {
+			t.Fatalf("share %s wasn't mounted", id)
+		}
+	}
+
+	for _, path := range []string{"/Computers (1)/Laptop", "/Computers (1)/Laptop (1)"} {
+		link := self.linkByPath[path]
+		if link == nil || !link.IsShareRoot() {
+			t.Errorf("no share root at %s", path)
+		}
+	}
+
+	if link := self.linkByPath["/Computers"]; link == nil || link.ID() != "real" {
+		t.Errorf("real folder was replaced: %v", link)
+	}
+
+	if link := self.linkByPath["/Computers (1)"]; link == nil || !link.IsVirtual() {
+		t.Errorf("no virtual folder at /Computers (1)")
+	}
+}
+
+func TestMountShareSkipped(t *testing.T) {
+	self := testLinks()
+	self.mount = MountUnder("", "", "", "")
+
+	share := testShare("device", "device-root", proton.ShareTypeDevice)
+
+	if self.mountShare(share, testLink(share, "device-root", "Laptop", nil)) {
+		t.Errorf("share was mounted without a folder")
+	}
+}
+
+func TestMakeRoom(t *testing.T) {
+	self := testLinks()
+	self.mount = MountUnder("", "", "", "/Photos")
+
+	share := testShare("photos", "photos-root", ShareTypePhotos)
+	root := testLink(share, "photos-root", "Stream", nil)
+
+	if !self.mountShare(share, root) {
+		t.Fatal("share wasn't mounted")
+	}
+
+	// A real folder is created with the name of the mount
+	if change := self.makeRoom(self.root, "Documents"); change != nil {
+		t.Errorf("unrelated name moved a mount: %v", change)
+	}
+
+	change := self.makeRoom(self.root, "Photos")
+	if change == nil {
+		t.Fatal("mount wasn't moved")
+	}
+
+	expected := Change{Type: ChangeUpdate, LinkID: "photos-root", Path: "/Photos (1)", OldPath: "/Photos"}
+	if *change != expected {
+		t.Errorf("got %v, want %v", *change, expected)
+	}
+
+	testLink(self.share, "real", "Photos", self.root)
+	self.getLinkMaps()
+
+	if link := self.linkByPath["/Photos"]; link == nil || link.ID() != "real" {
+		t.Errorf("real folder isn't at /Photos")
+	}
+
+	if self.linkByPath["/Photos (1)"] != root {
+		t.Errorf("mount isn't at /Photos (1)")
+	}
+}
+
+func TestMakeRoomRealLink(t *testing.T) {
+	self := testLinks()
+
+	testLink(self.share, "real", "Photos", self.root)
+	self.getLinkMaps()
+
+	if change := self.makeRoom(self.root, "Photos"); change != nil {
+		t.Errorf("real link was moved: %v", change)
+	}
+}
@@ -0,0 +1,101 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pathlib "path"
+	"strings"
+
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/henrybear327/go-proton-api"
+)
+
+const (
+	namingBatchSize   = 10
+	namingMaxAttempts = 10
+)
+
+var (
+	ErrNoAvailableName = errors.New("no available name found")
+)
+
+type NamingPolicy int
+
+const (
+	// NamingExact uses the requested name as is.
+	NamingExact NamingPolicy = iota
+
+	// NamingUnique appends " (n)" to the requested name until it doesn't collide with an existing link.
+	NamingUnique
+)
+
+func WithNamingPolicy(policy NamingPolicy) Option {
+	return func(opts *options) {
+		opts.namingPolicy = policy
+	}
+}
+
+func (self *FileSystem) resolveName(ctx context.Context, parent *Link, name string, options *options) (string, error) {
+	if options.namingPolicy != NamingUnique {
+		return name, nil
+	}
+
+	return self.availableName(ctx, parent, name)
+}
+
+func (self *FileSystem) availableName(ctx context.Context, parent *Link, name string) (string, error) {
+	share := parent.Share()
+
+	for attempt := 0; attempt < namingMaxAttempts; attempt++ {
+		candidates := []string{}
+		hashes := []string{}
+
+		for i := 0; i < namingBatchSize; i++ {
+			candidate := numberedName(name, attempt*namingBatchSize+i)
+
+			hash, err := proton.GetNameHash(candidate, parent.HashKey())
+			if err != nil {
+				return "", err
+			}
+
+			candidates = append(candidates, candidate)
+			hashes = append(hashes, hash)
+		}
+
+		rsp, err := self.client.CheckAvailableHashes(ctx, share.ID(), parent.ID(), proton.CheckAvailableHashesReq{
+			Hashes: hashes,
+		})
+
+		if err != nil {
+			return "", err
+		}
+
+		available := mapset.NewThreadUnsafeSet(rsp.AvailableHashes...)
+
+		for i, candidate := range candidates {
+			if available.Contains(hashes[i]) {
+				return candidate, nil
+			}
+		}
+	}
+
+	return "", ErrNoAvailableName
+}
+
+// numberedName turns "report.pdf" into "report (n).pdf", the same way the official clients do.
+func numberedName(name string, n int) string {
+	if n == 0 {
+		return name
+	}
+
+	ext := pathlib.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	if base == "" {
+		base = name
+		ext = ""
+	}
+
+	return fmt.Sprintf("%s (%d)%s", base, n, ext)
+}
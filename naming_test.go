@@ -0,0 +1,68 @@
+package drive
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNumberedName(t *testing.T) {
+	tests := []struct {
+		name     string
+		n        int
+		expected string
+	}{
+		{"report.pdf", 0, "report.pdf"},
+		{"report.pdf", 1, "report (1).pdf"},
+		{"report.pdf", 12, "report (12).pdf"},
+		{"archive.tar.gz", 2, "archive.tar (2).gz"},
+		{"Documents", 3, "Documents (3)"},
+		{".bashrc", 1, ".bashrc (1)"},
+		{"notes.", 1, "notes (1)."},
+	}
+
+	for _, test := range tests {
+		if name := numberedName(test.name, test.n); name != test.expected {
+			t.Errorf("%q, %d: got %q, want %q", test.name, test.n, name, test.expected)
+		}
+	}
+}
+
+func TestResolveNameExact(t *testing.T) {
+	// The exact policy doesn't check the name with the API
+	self := &FileSystem{}
+
+	for _, opts := range [][]Option{nil, {WithNamingPolicy(NamingExact)}} {
+		name, err := self.resolveName(context.Background(), nil, "report.pdf", newOptions(opts))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if name != "report.pdf" {
+			t.Errorf("got %q, want %q", name, "report.pdf")
+		}
+	}
+}
+
+func TestFreeName(t *testing.T) {
+	self := testLinks()
+
+	testLink(self.share, "a", "Shared", self.root)
+	testLink(self.share, "b", "Shared (1)", self.root)
+
+	virtual := testLink(nil, "virtual:/Shared (2)", "Shared (2)", self.root)
+	virtual.virtual = true
+
+	self.getLinkMaps()
+
+	if name := self.freeName(self.root, "Shared", nil); name != "Shared (3)" {
+		t.Errorf("got %q, want %q", name, "Shared (3)")
+	}
+
+	if name := self.freeName(self.root, "Shared", (*Link).IsVirtual); name != "Shared (2)" {
+		t.Errorf("reused: got %q, want %q", name, "Shared (2)")
+	}
+
+	if name := self.freeName(self.root, "Photos", nil); name != "Photos" {
+		t.Errorf("free: got %q, want %q", name, "Photos")
+	}
+}
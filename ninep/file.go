@@ -0,0 +1,426 @@
+package ninep
+
+import (
+	"errors"
+	"io"
+	pathlib "path"
+	"sort"
+	"sync"
+	"time"
+
+	drive "github.com/StollD/proton-drive"
+	"github.com/hugelgupf/p9/fsimpl/readdir"
+	"github.com/hugelgupf/p9/fsimpl/templatefs"
+	"github.com/hugelgupf/p9/linux"
+	"github.com/hugelgupf/p9/p9"
+)
+
+const (
+	// Linux open(2) and unlinkat(2) flags, which 9P2000.L passes through unchanged
+	openTruncate    p9.OpenFlags = 0x200
+	unlinkRemoveDir uint32       = 0x200
+)
+
+var _ p9.File = &file{}
+
+// file is a fid referring to a link. Links are tracked by ID, so a fid stays valid when the link is renamed.
+type file struct {
+	templatefs.NoopFile
+
+	//
+	// PARAMETERS
+	//
+
+	server *Server
+	linkID string
+
+	//
+	// INTERNAL STATE
+	//
+
+	reader *drive.FileReader
+	writer *drive.FileWriter
+
+	// Set by SetAttr, so the file can be opened for writing without O_TRUNC
+	truncated bool
+
+	// A file from Create has no link until its writer is committed
+	parentID string
+	name     string
+
+	lock sync.Mutex
+}
+
+func (self *file) link() (*drive.Link, error) {
+	link := self.server.session.Links().LinkFromID(self.linkID)
+	if link == nil {
+		return nil, linux.ENOENT
+	}
+
+	return link, nil
+}
+
+func (self *file) child(name string) (*drive.Link, error) {
+	link, err := self.link()
+	if err != nil {
+		return nil, err
+	}
+
+	if !link.IsDir() {
+		return nil, linux.ENOTDIR
+	}
+
+	child := self.server.session.Links().LinkFromPath(pathlib.Join(link.Path(), name))
+	if child == nil {
+		return nil, linux.ENOENT
+	}
+
+	return child, nil
+}
+
+func (self *file) dir() (*drive.Link, error) {
+	link, err := self.link()
+	if err != nil {
+		return nil, err
+	}
+
+	if !link.IsDir() {
+		return nil, linux.ENOTDIR
+	}
+
+	return link, nil
+}
+
+func (self *file) Walk(names []string) ([]p9.QID, p9.File, error) {
+	if len(names) == 0 {
+		return nil, &file{server: self.server, linkID: self.linkID}, nil
+	}
+
+	qids := make([]p9.QID, 0, len(names))
+	walker := self
+
+	for _, name := range names {
+		link, err := walker.child(name)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		qids = append(qids, self.server.qid(link))
+		walker = &file{server: self.server, linkID: link.ID()}
+	}
+
+	return qids, walker, nil
+}
+
+func (self *file) GetAttr(_ p9.AttrMask) (p9.QID, p9.AttrMask, p9.Attr, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	link, err := self.link()
+	if err == nil {
+		attr := self.server.attr(link)
+
+		if self.writer != nil {
+			attr.Size = uint64(self.writer.Size())
+		}
+
+		return self.server.qid(link), p9.AttrMaskAll, attr, nil
+	}
+
+	if self.writer == nil {
+		return p9.QID{}, p9.AttrMask{}, p9.Attr{}, err
+	}
+
+	// A new file that hasn't been committed yet
+	modTime := self.writer.ModTime()
+
+	attr := p9.Attr{
+		Mode:      p9.ModeRegular | 0644,
+		UID:       self.server.uid,
+		GID:       self.server.gid,
+		NLink:     1,
+		Size:      uint64(self.writer.Size()),
+		BlockSize: statBlockSize,
+	}
+
+	attr.MTimeSeconds, attr.MTimeNanoSeconds = uint64(modTime.Unix()), uint64(modTime.Nanosecond())
+
+	return self.pendingQID(), p9.AttrMaskAll, attr, nil
+}
+
+func (self *file) pendingQID() p9.QID {
+	return p9.QID{Type: p9.TypeRegular, Path: hash64(self.parentID + "/" + self.name)}
+}
+
+func (self *file) SetAttr(valid p9.SetAttrMask, attr p9.SetAttr) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if valid.Size {
+		size := int64(-1)
+
+		if self.writer != nil {
+			size = self.writer.Size()
+		} else if link, err := self.link(); err == nil {
+			size = link.Size()
+		}
+
+		// Only truncating to zero can be done without rewriting the file, and that happens on the next open
+		if int64(attr.Size) != size && attr.Size != 0 {
+			return linux.EOPNOTSUPP
+		}
+
+		if attr.Size == 0 {
+			self.truncated = true
+		}
+	}
+
+	if valid.MTime && valid.MTimeNotSystemTime && self.writer != nil {
+		self.writer.SetModTime(time.Unix(int64(attr.MTimeSeconds), int64(attr.MTimeNanoSeconds)))
+	}
+
+	// Permissions and ownership can't be stored on the drive
+	return nil
+}
+
+func (self *file) StatFS() (p9.FSStat, error) {
+	return self.server.statFS(), nil
+}
+
+func (self *file) Open(mode p9.OpenFlags) (p9.QID, uint32, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	link, err := self.link()
+	if err != nil {
+		return p9.QID{}, 0, err
+	}
+
+	fs := self.server.session.FileSystem()
+
+	if mode.Mode() == p9.ReadOnly {
+		if link.IsFile() {
+			self.reader, err = fs.Download(self.server.ctx, link)
+			if err != nil {
+				return p9.QID{}, 0, convertError(err)
+			}
+		}
+
+		return self.server.qid(link), 0, nil
+	}
+
+	if !link.IsFile() {
+		return p9.QID{}, 0, linux.EISDIR
+	}
+
+	// Rewriting parts of a file would require downloading it first
+	if mode.Mode() == p9.ReadWrite || (mode&openTruncate == 0 && !self.truncated && link.Size() > 0) {
+		return p9.QID{}, 0, linux.EOPNOTSUPP
+	}
+
+	self.writer, err = fs.Upload(self.server.ctx, link.Parent(), link.Name())
+	if err != nil {
+		return p9.QID{}, 0, convertError(err)
+	}
+
+	return self.server.qid(link), 0, nil
+}
+
+func (self *file) ReadAt(buffer []byte, offset int64) (int, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.reader == nil {
+		return 0, linux.EBADF
+	}
+
+	_, err := self.reader.Seek(offset, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.ReadFull(self.reader, buffer)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+// WriteAt streams sequential writes into the FileWriter. The Linux client writes files front to back, so anything
+// else would be an attempt to modify existing content.
+func (self *file) WriteAt(buffer []byte, offset int64) (int, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.writer == nil {
+		return 0, linux.EBADF
+	}
+
+	if offset != self.writer.Size() {
+		return 0, linux.EOPNOTSUPP
+	}
+
+	return self.writer.Write(buffer)
+}
+
+func (self *file) Create(
+	name string, _ p9.OpenFlags, _ p9.FileMode, _ p9.UID, _ p9.GID,
+) (p9.File, p9.QID, uint32, error) {
+	parent, err := self.dir()
+	if err != nil {
+		return nil, p9.QID{}, 0, err
+	}
+
+	// The client only creates files after looking them up, so an existing file is a conflict
+	writer, err := self.server.session.FileSystem().Upload(
+		self.server.ctx, parent, name, drive.WithCreateMode(drive.CreateExclusive),
+	)
+	if err != nil {
+		return nil, p9.QID{}, 0, convertError(err)
+	}
+
+	created := &file{
+		server:   self.server,
+		writer:   writer,
+		parentID: parent.ID(),
+		name:     name,
+	}
+
+	return created, created.pendingQID(), 0, nil
+}
+
+func (self *file) Mkdir(name string, _ p9.FileMode, _ p9.UID, _ p9.GID) (p9.QID, error) {
+	parent, err := self.dir()
+	if err != nil {
+		return p9.QID{}, err
+	}
+
+	link, err := self.server.session.FileSystem().CreateDir(self.server.ctx, parent, name)
+	if err != nil {
+		return p9.QID{}, convertError(err)
+	}
+
+	return self.server.qid(link), nil
+}
+
+func (self *file) Rename(newDir p9.File, newName string) error {
+	link, err := self.link()
+	if err != nil {
+		return err
+	}
+
+	return self.server.rename(link, newDir, newName)
+}
+
+func (self *file) RenameAt(oldName string, newDir p9.File, newName string) error {
+	link, err := self.child(oldName)
+	if err != nil {
+		return err
+	}
+
+	return self.server.rename(link, newDir, newName)
+}
+
+func (self *Server) rename(link *drive.Link, newDir p9.File, newName string) error {
+	target, ok := newDir.(*file)
+	if !ok {
+		return linux.EINVAL
+	}
+
+	parent, err := target.dir()
+	if err != nil {
+		return err
+	}
+
+	fs := self.session.FileSystem()
+
+	// Like rename(2), replace an existing file at the destination
+	existing := self.session.Links().LinkFromPath(pathlib.Join(parent.Path(), newName))
+	if existing != nil && existing != link {
+		if existing.IsDir() != link.IsDir() {
+			return linux.EISDIR
+		}
+
+		if existing.IsDir() && existing.Children().Cardinality() > 0 {
+			return linux.ENOTEMPTY
+		}
+
+		err := fs.Delete(self.ctx, existing)
+		if err != nil {
+			return convertError(err)
+		}
+	}
+
+	_, err = fs.Move(self.ctx, link, parent, newName)
+	return convertError(err)
+}
+
+func (self *file) UnlinkAt(name string, flags uint32) error {
+	link, err := self.child(name)
+	if err != nil {
+		return err
+	}
+
+	if flags&unlinkRemoveDir != 0 {
+		if !link.IsDir() {
+			return linux.ENOTDIR
+		}
+
+		if link.Children().Cardinality() > 0 {
+			return linux.ENOTEMPTY
+		}
+	} else if link.IsDir() {
+		return linux.EISDIR
+	}
+
+	return convertError(self.server.session.FileSystem().Delete(self.server.ctx, link))
+}
+
+func (self *file) Readdir(offset uint64, count uint32) (p9.Dirents, error) {
+	link, err := self.dir()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	qids := map[string]p9.QID{}
+
+	for child := range link.Children().Iter() {
+		names = append(names, child.Name())
+		qids[child.Name()] = self.server.qid(child)
+	}
+
+	// Offsets are indices, so the order has to be stable between calls
+	sort.Strings(names)
+
+	return readdir.Readdir(offset, count, names, qids)
+}
+
+func (self *file) FSync() error {
+	return nil
+}
+
+func (self *file) Close() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.reader != nil {
+		_ = self.reader.Close()
+		self.reader = nil
+	}
+
+	if self.writer == nil {
+		return nil
+	}
+
+	link, err := self.writer.Commit()
+	if err != nil {
+		return convertError(err)
+	}
+
+	self.linkID = link.ID()
+	self.writer = nil
+
+	return nil
+}
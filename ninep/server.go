@@ -0,0 +1,152 @@
+package ninep
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"net"
+	"os"
+
+	drive "github.com/StollD/proton-drive"
+	"github.com/hugelgupf/p9/linux"
+	"github.com/hugelgupf/p9/p9"
+)
+
+const (
+	// Reported by statfs so guests identify the mount as v9fs
+	v9fsMagic = 0x01021997
+
+	statBlockSize = 4096
+	maxNameLength = 255
+)
+
+var _ p9.Attacher = &Server{}
+
+// Server serves the link tree of a session over 9P2000.L, e.g. to QEMU guests (virtio-9p) or LXC containers.
+type Server struct {
+	//
+	// PARAMETERS
+	//
+
+	session *drive.Session
+
+	uid p9.UID
+	gid p9.GID
+
+	//
+	// INTERNAL STATE
+	//
+
+	ctx context.Context
+}
+
+// NewServer creates a 9P server. Files are reported as owned by the user running the server.
+func NewServer(session *drive.Session) *Server {
+	return &Server{
+		session: session,
+		uid:     p9.UID(os.Getuid()),
+		gid:     p9.GID(os.Getgid()),
+		ctx:     context.Background(),
+	}
+}
+
+// SetOwner changes the user and group that files are reported as owned by.
+func (self *Server) SetOwner(uid uint32, gid uint32) {
+	self.uid = p9.UID(uid)
+	self.gid = p9.GID(gid)
+}
+
+// Serve accepts 9P connections on the listener until the context is canceled.
+func (self *Server) Serve(ctx context.Context, listener net.Listener) error {
+	self.ctx = ctx
+	return p9.NewServer(self).ServeContext(ctx, listener)
+}
+
+func (self *Server) Attach() (p9.File, error) {
+	return &file{server: self, linkID: self.session.Links().Root().ID()}, nil
+}
+
+func (self *Server) qid(link *drive.Link) p9.QID {
+	if link.IsDir() {
+		return p9.QID{Type: p9.TypeDir, Path: hash64(link.ID())}
+	}
+
+	// The version changes with every revision, so clients drop their cached pages
+	return p9.QID{Type: p9.TypeRegular, Path: hash64(link.ID()), Version: hash32(link.RevisionID())}
+}
+
+func (self *Server) attr(link *drive.Link) p9.Attr {
+	attr := p9.Attr{
+		Mode:      p9.FileMode(link.Mode().Perm()),
+		UID:       self.uid,
+		GID:       self.gid,
+		NLink:     1,
+		BlockSize: statBlockSize,
+	}
+
+	if link.IsDir() {
+		attr.Mode |= p9.ModeDirectory
+		attr.NLink = 2
+	} else {
+		attr.Mode |= p9.ModeRegular
+		attr.Size = uint64(link.Size())
+		attr.Blocks = (attr.Size + 511) / 512
+	}
+
+	mtime := link.ModificationTime()
+	btime := link.CreationTime()
+
+	attr.ATimeSeconds, attr.ATimeNanoSeconds = uint64(mtime.Unix()), uint64(mtime.Nanosecond())
+	attr.MTimeSeconds, attr.MTimeNanoSeconds = uint64(mtime.Unix()), uint64(mtime.Nanosecond())
+	attr.CTimeSeconds, attr.CTimeNanoSeconds = uint64(mtime.Unix()), uint64(mtime.Nanosecond())
+	attr.BTimeSeconds, attr.BTimeNanoSeconds = uint64(btime.Unix()), uint64(btime.Nanosecond())
+
+	return attr
+}
+
+func (self *Server) statFS() p9.FSStat {
+	user := self.session.User()
+
+	total := uint64(user.MaxSpace()) / statBlockSize
+	used := min(uint64(user.UsedSpace())/statBlockSize, total)
+
+	return p9.FSStat{
+		Type:            v9fsMagic,
+		BlockSize:       statBlockSize,
+		Blocks:          total,
+		BlocksFree:      total - used,
+		BlocksAvailable: total - used,
+		NameLength:      maxNameLength,
+	}
+}
+
+func hash64(value string) uint64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(value))
+
+	return hash.Sum64()
+}
+
+func hash32(value string) uint32 {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(value))
+
+	return hash.Sum32()
+}
+
+func convertError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, drive.ErrInvalidLink):
+		return linux.ENOENT
+	case errors.Is(err, drive.ErrAlreadyExists):
+		return linux.EEXIST
+	case errors.Is(err, drive.ErrInvalidLinkType):
+		return linux.EINVAL
+	case errors.Is(err, drive.ErrReadOnly), errors.Is(err, drive.ErrMountPoint):
+		return linux.EACCES
+	}
+
+	return err
+}
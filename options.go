@@ -0,0 +1,59 @@
+package drive
+
+type CreateMode int
+
+const (
+	// CreateOverwrite creates the file if it doesn't exist, or adds a new revision to it if it does.
+	CreateOverwrite CreateMode = iota
+
+	// CreateExclusive only creates new files and fails with ErrAlreadyExists if the name is taken.
+	CreateExclusive
+
+	// CreateIfRevision only adds a new revision if the active revision of the file still matches.
+	CreateIfRevision
+)
+
+type Option func(*options)
+
+type options struct {
+	createMode CreateMode
+	revisionID string
+
+	namingPolicy NamingPolicy
+
+	mimeType string
+}
+
+func newOptions(opts []Option) *options {
+	out := &options{
+		createMode:   CreateOverwrite,
+		namingPolicy: NamingExact,
+	}
+
+	for _, opt := range opts {
+		opt(out)
+	}
+
+	return out
+}
+
+func WithCreateMode(mode CreateMode) Option {
+	return func(opts *options) {
+		opts.createMode = mode
+	}
+}
+
+// WithRevision makes the operation conditional on the active revision of the target file (see CreateIfRevision).
+func WithRevision(revisionID string) Option {
+	return func(opts *options) {
+		opts.createMode = CreateIfRevision
+		opts.revisionID = revisionID
+	}
+}
+
+// WithMIMEType sets the MIME type of newly created files, instead of detecting it from their name and content.
+func WithMIMEType(mimeType string) Option {
+	return func(opts *options) {
+		opts.mimeType = mimeType
+	}
+}
@@ -0,0 +1,45 @@
+package drive
+
+import (
+	"sort"
+
+	"github.com/henrybear327/go-proton-api"
+)
+
+// ShareTypePhotos is the type of the share that holds the photos stream. The API client doesn't define it.
+const ShareTypePhotos proton.ShareType = 4
+
+// Photos returns the photos in the photos share, newest first, if the share is mounted with Links.SetMount. They can
+// be downloaded with the FileSystem like any other file. The API client doesn't expose the capture time of photos, so
+// they are ordered by their modification time instead.
+func (self *Session) Photos() []*Link {
+	photos := []*Link{}
+
+	var walk func(link *Link)
+	walk = func(link *Link) {
+		if link.IsFile() {
+			photos = append(photos, link)
+		}
+
+		for child := range link.Children().Iter() {
+			walk(child)
+		}
+	}
+
+	for _, share := range self.links.Shares() {
+		if share.Type() != ShareTypePhotos {
+			continue
+		}
+
+		root := self.links.LinkFromID(share.LinkID())
+		if root != nil {
+			walk(root)
+		}
+	}
+
+	sort.Slice(photos, func(i, j int) bool {
+		return photos[i].ModificationTime().After(photos[j].ModificationTime())
+	})
+
+	return photos
+}
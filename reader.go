@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"io"
 
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
@@ -16,6 +17,7 @@ var (
 	ErrOutOfRange              = errors.New("out of range read")
 	ErrBlockAddressNotFound    = errors.New("block signature address not found")
 	ErrBlockVerificationFailed = errors.New("block verification failed")
+	ErrBlockSignatureInvalid   = errors.New("block signature invalid")
 	ErrInvalidSeekOperation    = errors.New("invalid seek operation")
 )
 
@@ -32,6 +34,7 @@ type FileReader struct {
 
 	client *proton.Client
 	user   *User
+	links  *Links
 	link   *Link
 
 	blocks []proton.Block
@@ -45,6 +48,9 @@ type FileReader struct {
 	blockData   *bytes.Reader
 
 	streamOffset int64
+
+	// Signature errors are reported once per reader, not for every block
+	signatureReported bool
 }
 
 func (self *FileReader) Read(buffer []byte) (int, error) {
@@ -98,11 +104,6 @@ func (self *FileReader) updateCurrentBlock() error {
 
 	block := self.blocks[index]
 
-	address := self.user.AddressFromEmail(block.SignatureEmail)
-	if address == nil {
-		return ErrBlockAddressNotFound
-	}
-
 	reader, err := self.client.GetBlock(self.ctx, block.BareURL, block.Token)
 	if err != nil {
 		return err
@@ -129,12 +130,7 @@ func (self *FileReader) updateCurrentBlock() error {
 		return err
 	}
 
-	signature, err := crypto.NewPGPMessageFromArmored(block.EncSignature)
-	if err != nil {
-		return err
-	}
-
-	err = address.Keyring().VerifyDetachedEncrypted(decrypted, signature, self.link.Keyring(), crypto.GetUnixTime())
+	err = self.verifyBlock(block, decrypted)
 	if err != nil {
 		return err
 	}
@@ -146,6 +142,43 @@ func (self *FileReader) updateCurrentBlock() error {
 	return nil
 }
 
+// verifyBlock checks the signature of a block. Blocks signed by other users are verified with their public keys. If
+// the signature can't be verified, the signature policy decides whether the block is read anyway.
+func (self *FileReader) verifyBlock(block proton.Block, decrypted *crypto.PlainMessage) error {
+	address, err := self.user.PublicAddress(self.ctx, block.SignatureEmail)
+	if err != nil && !errors.Is(err, ErrPublicKeysNotFound) {
+		return err
+	}
+
+	if err != nil {
+		return self.signatureError(fmt.Errorf("%w %q: %w", ErrBlockAddressNotFound, block.SignatureEmail, err))
+	}
+
+	signature, err := crypto.NewPGPMessageFromArmored(block.EncSignature)
+	if err == nil {
+		err = address.Keyring().VerifyDetachedEncrypted(decrypted, signature, self.link.Keyring(), crypto.GetUnixTime())
+	}
+
+	if err != nil {
+		return self.signatureError(fmt.Errorf("%w: %w", ErrBlockSignatureInvalid, err))
+	}
+
+	return nil
+}
+
+func (self *FileReader) signatureError(err error) error {
+	if self.signatureReported && self.links.signatures != SignatureReject {
+		return nil
+	}
+
+	err = self.links.checkBlockSignature(self.link, err)
+	if err == nil {
+		self.signatureReported = true
+	}
+
+	return err
+}
+
 func (self *FileReader) Size() int64 {
 	var size int64 = 0
 
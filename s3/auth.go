@@ -0,0 +1,400 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+const (
+	signingAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateLayout    = "20060102T150405Z"
+	maxClockSkew     = 15 * time.Minute
+
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+	streamingPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	emptySHA256      = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	// Clients send chunks of 64 KiB by default, anything larger than a block is refused before it is buffered
+	maxChunkSize = drive.BlockSize
+)
+
+var (
+	ErrAccessDenied          = errors.New("access denied")
+	ErrInvalidAccessKeyID    = errors.New("invalid access key id")
+	ErrSignatureDoesNotMatch = errors.New("signature does not match")
+	ErrAuthorizationInvalid  = errors.New("malformed authorization")
+	ErrRequestExpired        = errors.New("request expired or clock skewed")
+	ErrContentSHA256Mismatch = errors.New("content sha256 mismatch")
+	ErrChunkSignatureInvalid = errors.New("chunk signature invalid")
+)
+
+// signature holds the parts of a verified AWS signature V4 that are needed to check the signatures of the chunks
+// of a streaming upload.
+type signature struct {
+	key   []byte
+	date  string
+	scope string
+	value string
+}
+
+// authenticate verifies the AWS signature V4 of a request against the configured credentials, either from the
+// Authorization header or from the query string of a presigned URL. On success, the body of the request is wrapped
+// so that its content is verified while it's read.
+func (self *Handler) authenticate(r *http.Request) error {
+	query := r.URL.Query()
+
+	if query.Get("X-Amz-Algorithm") != "" {
+		return self.authenticatePresigned(r, query)
+	}
+
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return ErrAccessDenied
+	}
+
+	algorithm, params, ok := strings.Cut(header, " ")
+	if !ok || algorithm != signingAlgorithm {
+		return ErrAuthorizationInvalid
+	}
+
+	fields := map[string]string{}
+
+	for _, param := range strings.Split(params, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok {
+			return ErrAuthorizationInvalid
+		}
+
+		fields[key] = value
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	if amzDate == "" {
+		amzDate = r.Header.Get("Date")
+	}
+
+	date, err := time.Parse(amzDateLayout, amzDate)
+	if err != nil {
+		return ErrAuthorizationInvalid
+	}
+
+	if time.Since(date).Abs() > maxClockSkew {
+		return ErrRequestExpired
+	}
+
+	payload := r.Header.Get("X-Amz-Content-Sha256")
+	if payload == "" {
+		payload = emptySHA256
+	}
+
+	credential, signedHeaders, signature := fields["Credential"], fields["SignedHeaders"], fields["Signature"]
+
+	sig, err := self.verify(r, query, amzDate, credential, signedHeaders, signature, payload)
+	if err != nil {
+		return err
+	}
+
+	switch payload {
+	case unsignedPayload:
+		// Nothing to verify
+	case streamingPayload:
+		r.Body = &chunkedReader{body: r.Body, reader: bufio.NewReader(r.Body), sig: sig}
+
+		length, err := strconv.ParseInt(r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+		if err == nil {
+			r.ContentLength = length
+		}
+	default:
+		r.Body = &hashingReader{body: r.Body, hash: sha256.New(), expected: payload}
+	}
+
+	return nil
+}
+
+func (self *Handler) authenticatePresigned(r *http.Request, query url.Values) error {
+	if query.Get("X-Amz-Algorithm") != signingAlgorithm {
+		return ErrAuthorizationInvalid
+	}
+
+	amzDate := query.Get("X-Amz-Date")
+
+	date, err := time.Parse(amzDateLayout, amzDate)
+	if err != nil {
+		return ErrAuthorizationInvalid
+	}
+
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil {
+		return ErrAuthorizationInvalid
+	}
+
+	now := time.Now()
+
+	if now.Before(date.Add(-maxClockSkew)) || now.After(date.Add(time.Duration(expires)*time.Second)) {
+		return ErrRequestExpired
+	}
+
+	signed := query.Get("X-Amz-Signature")
+	query.Del("X-Amz-Signature")
+
+	_, err = self.verify(
+		r,
+		query,
+		amzDate,
+		query.Get("X-Amz-Credential"),
+		query.Get("X-Amz-SignedHeaders"),
+		signed,
+		unsignedPayload,
+	)
+
+	return err
+}
+
+func (self *Handler) verify(
+	r *http.Request,
+	query url.Values,
+	amzDate string,
+	credential string,
+	signedHeaders string,
+	signed string,
+	payload string,
+) (*signature, error) {
+	// <access key>/<date>/<region>/<service>/aws4_request
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[4] != "aws4_request" || signedHeaders == "" || signed == "" {
+		return nil, ErrAuthorizationInvalid
+	}
+
+	secret, ok := self.credentials[parts[0]]
+	if !ok {
+		return nil, ErrInvalidAccessKeyID
+	}
+
+	scope := strings.Join(parts[1:], "/")
+
+	canonical := strings.Join([]string{
+		r.Method,
+		uriEncode(r.URL.Path, false),
+		canonicalQuery(query),
+		canonicalHeaders(r, signedHeaders),
+		signedHeaders,
+		payload,
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secret), []byte(parts[1]))
+	key = hmacSHA256(key, []byte(parts[2]))
+	key = hmacSHA256(key, []byte(parts[3]))
+	key = hmacSHA256(key, []byte("aws4_request"))
+
+	stringToSign := strings.Join([]string{signingAlgorithm, amzDate, scope, sha256Hex([]byte(canonical))}, "\n")
+	expected := hex.EncodeToString(hmacSHA256(key, []byte(stringToSign)))
+
+	if !hmac.Equal([]byte(expected), []byte(signed)) {
+		return nil, ErrSignatureDoesNotMatch
+	}
+
+	return &signature{key: key, date: amzDate, scope: scope, value: signed}, nil
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	out := []string{}
+
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+
+		for _, value := range values {
+			out = append(out, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+
+	return strings.Join(out, "&")
+}
+
+func canonicalHeaders(r *http.Request, signedHeaders string) string {
+	out := strings.Builder{}
+
+	for _, name := range strings.Split(signedHeaders, ";") {
+		var value string
+
+		switch name {
+		case "host":
+			value = r.Host
+		case "content-length":
+			value = strconv.FormatInt(r.ContentLength, 10)
+		default:
+			values := r.Header.Values(name)
+			for i := range values {
+				values[i] = strings.Join(strings.Fields(values[i]), " ")
+			}
+
+			value = strings.Join(values, ",")
+		}
+
+		out.WriteString(name + ":" + value + "\n")
+	}
+
+	return out.String()
+}
+
+// uriEncode encodes a string the way AWS expects it in canonical requests.
+func uriEncode(value string, encodeSlash bool) string {
+	out := strings.Builder{}
+
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9':
+			out.WriteByte(b)
+		case b == '-' || b == '_' || b == '.' || b == '~':
+			out.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			out.WriteByte(b)
+		default:
+			fmt.Fprintf(&out, "%%%02X", b)
+		}
+	}
+
+	return out.String()
+}
+
+func hmacSHA256(key []byte, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hashingReader verifies the signed SHA256 of the payload once the body has been read completely.
+type hashingReader struct {
+	body     io.ReadCloser
+	hash     hash.Hash
+	expected string
+}
+
+func (self *hashingReader) Read(buffer []byte) (int, error) {
+	n, err := self.body.Read(buffer)
+	self.hash.Write(buffer[:n])
+
+	if err == io.EOF && hex.EncodeToString(self.hash.Sum(nil)) != self.expected {
+		return n, ErrContentSHA256Mismatch
+	}
+
+	return n, err
+}
+
+func (self *hashingReader) Close() error {
+	return self.body.Close()
+}
+
+// chunkedReader decodes the aws-chunked content encoding and verifies the signature of every chunk.
+type chunkedReader struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+	sig    *signature
+
+	chunk []byte
+	done  bool
+}
+
+func (self *chunkedReader) Read(buffer []byte) (int, error) {
+	for len(self.chunk) == 0 {
+		if self.done {
+			return 0, io.EOF
+		}
+
+		err := self.nextChunk()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(buffer, self.chunk)
+	self.chunk = self.chunk[n:]
+
+	return n, nil
+}
+
+func (self *chunkedReader) nextChunk() error {
+	// <hex size>;chunk-signature=<signature>\r\n<data>\r\n
+	line, err := self.reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+
+	sizeHex, params, ok := strings.Cut(strings.TrimSpace(line), ";")
+	if !ok || !strings.HasPrefix(params, "chunk-signature=") {
+		return ErrChunkSignatureInvalid
+	}
+
+	size, err := strconv.ParseInt(sizeHex, 16, 64)
+	if err != nil || size < 0 || size > maxChunkSize {
+		return ErrChunkSignatureInvalid
+	}
+
+	chunk := make([]byte, size)
+
+	_, err = io.ReadFull(self.reader, chunk)
+	if err != nil {
+		return err
+	}
+
+	trailer := make([]byte, 2)
+
+	_, err = io.ReadFull(self.reader, trailer)
+	if err != nil || !bytes.Equal(trailer, []byte("\r\n")) {
+		return ErrChunkSignatureInvalid
+	}
+
+	stringToSign := strings.Join([]string{
+		signingAlgorithm + "-PAYLOAD",
+		self.sig.date,
+		self.sig.scope,
+		self.sig.value,
+		emptySHA256,
+		sha256Hex(chunk),
+	}, "\n")
+
+	expected := hex.EncodeToString(hmacSHA256(self.sig.key, []byte(stringToSign)))
+	signed := strings.TrimPrefix(params, "chunk-signature=")
+
+	if !hmac.Equal([]byte(expected), []byte(signed)) {
+		return ErrChunkSignatureInvalid
+	}
+
+	self.sig.value = signed
+	self.chunk = chunk
+	self.done = size == 0
+
+	return nil
+}
+
+func (self *chunkedReader) Close() error {
+	return self.body.Close()
+}
@@ -0,0 +1,290 @@
+package s3
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"net/http"
+	pathlib "path"
+	"sort"
+	"strconv"
+	"strings"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+const (
+	defaultMaxKeys = 1000
+)
+
+func (self *Handler) listBuckets(w http.ResponseWriter) error {
+	root := self.session.Links().Root()
+	result := &listBucketsResult{Xmlns: xmlNamespace, Buckets: []bucket{}}
+
+	for child := range root.Children().Iter() {
+		if !child.IsDir() {
+			continue
+		}
+
+		result.Buckets = append(result.Buckets, bucket{
+			Name:         child.Name(),
+			CreationDate: formatTime(child.CreationTime()),
+		})
+	}
+
+	sort.Slice(result.Buckets, func(i, j int) bool {
+		return result.Buckets[i].Name < result.Buckets[j].Name
+	})
+
+	writeXML(w, http.StatusOK, result)
+	return nil
+}
+
+func (self *Handler) getBucketLocation(w http.ResponseWriter, name string) error {
+	_, err := self.bucket(name)
+	if err != nil {
+		return err
+	}
+
+	writeXML(w, http.StatusOK, &locationConstraint{Xmlns: xmlNamespace})
+	return nil
+}
+
+func (self *Handler) createBucket(w http.ResponseWriter, r *http.Request, name string) error {
+	if strings.Contains(name, "/") {
+		return errInvalidBucketName
+	}
+
+	if self.session.Links().LinkFromPath(pathlib.Join("/", name)) != nil {
+		return errBucketExists
+	}
+
+	_, err := self.session.FileSystem().CreateDir(r.Context(), self.session.Links().Root(), name)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Location", "/"+name)
+	w.WriteHeader(http.StatusOK)
+
+	return nil
+}
+
+func (self *Handler) deleteBucket(w http.ResponseWriter, r *http.Request, name string) error {
+	link, err := self.bucket(name)
+	if err != nil {
+		return err
+	}
+
+	if link.Children().Cardinality() > 0 {
+		return errBucketNotEmpty
+	}
+
+	err = self.session.FileSystem().Delete(r.Context(), link)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+type listEntry struct {
+	key  string
+	link *drive.Link
+}
+
+// walk collects all links of a bucket whose keys start with prefix, sorted by key. Folders are included with a
+// trailing slash so they can show up as common prefixes.
+func (self *Handler) walk(root *drive.Link, prefix string) []listEntry {
+	start := root
+
+	if idx := strings.LastIndex(prefix, "/"); idx != -1 {
+		if checkKey(prefix[:idx]) != nil {
+			return nil
+		}
+
+		start = self.session.Links().LinkFromPath(pathlib.Join(root.Path(), prefix[:idx]))
+		if start == nil || !start.IsDir() {
+			return nil
+		}
+	}
+
+	entries := []listEntry{}
+
+	var walk func(link *drive.Link)
+	walk = func(link *drive.Link) {
+		for child := range link.Children().Iter() {
+			key := strings.TrimPrefix(child.Path(), root.Path()+"/")
+
+			if child.IsDir() {
+				key += "/"
+			}
+
+			if strings.HasPrefix(key, prefix) {
+				entries = append(entries, listEntry{key: key, link: child})
+			} else if !strings.HasPrefix(prefix, key) {
+				continue
+			}
+
+			if child.IsDir() {
+				walk(child)
+			}
+		}
+	}
+
+	walk(start)
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+
+	return entries
+}
+
+func (self *Handler) listObjects(w http.ResponseWriter, r *http.Request, name string, v2 bool) error {
+	root, err := self.bucket(name)
+	if err != nil {
+		return err
+	}
+
+	query := r.URL.Query()
+
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+
+	maxKeys := defaultMaxKeys
+	if value := query.Get("max-keys"); value != "" {
+		maxKeys, err = strconv.Atoi(value)
+		if err != nil || maxKeys < 0 {
+			return errInvalidArgument
+		}
+	}
+
+	result := &listBucketResult{
+		Xmlns:     xmlNamespace,
+		Name:      name,
+		Prefix:    prefix,
+		Delimiter: delimiter,
+		MaxKeys:   maxKeys,
+	}
+
+	marker := ""
+
+	if v2 {
+		result.StartAfter = query.Get("start-after")
+		result.ContinuationToken = query.Get("continuation-token")
+
+		marker = result.StartAfter
+
+		if result.ContinuationToken != "" {
+			decoded, err := base64.URLEncoding.DecodeString(result.ContinuationToken)
+			if err != nil {
+				return errInvalidArgument
+			}
+
+			marker = string(decoded)
+		}
+	} else {
+		marker = query.Get("marker")
+		result.Marker = &marker
+	}
+
+	last := ""
+	count := 0
+
+	for _, entry := range self.walk(root, prefix) {
+		if entry.key <= marker {
+			continue
+		}
+
+		key := entry.key
+		isPrefix := false
+
+		if delimiter != "" {
+			rest := strings.TrimPrefix(entry.key, prefix)
+
+			if idx := strings.Index(rest, delimiter); idx != -1 {
+				key = prefix + rest[:idx+len(delimiter)]
+				isPrefix = true
+			}
+		}
+
+		if isPrefix && (key <= marker || key == last) {
+			continue
+		}
+
+		if !isPrefix && entry.link.IsDir() {
+			continue
+		}
+
+		if count == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+
+		if isPrefix {
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: key})
+		} else {
+			result.Contents = append(result.Contents, object{
+				Key:          key,
+				LastModified: formatTime(entry.link.ModificationTime()),
+				ETag:         etag(entry.link),
+				Size:         entry.link.Size(),
+				StorageClass: "STANDARD",
+			})
+		}
+
+		last = key
+		count++
+	}
+
+	if result.IsTruncated {
+		if v2 {
+			result.NextContinuationToken = base64.URLEncoding.EncodeToString([]byte(last))
+		} else {
+			result.NextMarker = last
+		}
+	}
+
+	if v2 {
+		result.KeyCount = &count
+	}
+
+	writeXML(w, http.StatusOK, result)
+	return nil
+}
+
+func (self *Handler) deleteObjects(w http.ResponseWriter, r *http.Request, name string) error {
+	_, err := self.bucket(name)
+	if err != nil {
+		return err
+	}
+
+	request := &deleteRequest{}
+
+	err = xml.NewDecoder(r.Body).Decode(request)
+	if err != nil {
+		return errMalformedXML
+	}
+
+	result := &deleteResult{Xmlns: xmlNamespace}
+
+	for _, obj := range request.Objects {
+		err := self.delete(r, name, obj.Key)
+
+		if err != nil {
+			apiErr := toAPIError(err)
+
+			result.Errors = append(result.Errors, deleteError{
+				Key:     obj.Key,
+				Code:    apiErr.code,
+				Message: apiErr.message,
+			})
+		} else if !request.Quiet {
+			result.Deleted = append(result.Deleted, deletedObject{Key: obj.Key})
+		}
+	}
+
+	writeXML(w, http.StatusOK, result)
+	return nil
+}
@@ -0,0 +1,315 @@
+package s3
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+const (
+	maxPartNumber = 10000
+
+	// Uploads that are neither completed nor aborted are removed with their parts after this time
+	maxUploadAge = 24 * time.Hour
+)
+
+// multipartUpload keeps the parts of an upload on local disk until the upload is completed. Parts can arrive in
+// any order and concurrently, but a FileWriter has to be written sequentially, so the parts are only streamed into
+// it once the final order is known.
+type multipartUpload struct {
+	bucket      string
+	key         string
+	modTime     time.Time
+	contentType string
+	created     time.Time
+
+	parts map[int]*uploadPart
+	lock  sync.Mutex
+
+	// Set once the parts were removed, parts that arrive later are dropped
+	done bool
+}
+
+type uploadPart struct {
+	path string
+	etag string
+	hash []byte
+}
+
+func (self *multipartUpload) cleanup() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	for _, part := range self.parts {
+		_ = os.Remove(part.path)
+	}
+
+	self.parts = map[int]*uploadPart{}
+	self.done = true
+}
+
+// Close removes the parts of all uploads that weren't completed.
+func (self *Handler) Close() error {
+	self.lock.Lock()
+	uploads := self.uploads
+	self.uploads = map[string]*multipartUpload{}
+	self.lock.Unlock()
+
+	for _, upload := range uploads {
+		upload.cleanup()
+	}
+
+	return nil
+}
+
+// expireUploads removes the uploads that were started more than maxUploadAge ago. The caller has to hold the lock.
+func (self *Handler) expireUploads() {
+	for id, upload := range self.uploads {
+		if time.Since(upload.created) < maxUploadAge {
+			continue
+		}
+
+		delete(self.uploads, id)
+
+		// Parts of the upload may still be written or read, cleanup waits for them
+		go upload.cleanup()
+	}
+}
+
+func (self *Handler) upload(r *http.Request, bucket string, key string) (string, *multipartUpload, error) {
+	id := r.URL.Query().Get("uploadId")
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	upload, ok := self.uploads[id]
+	if !ok || upload.bucket != bucket || upload.key != key {
+		return "", nil, errNoSuchUpload
+	}
+
+	return id, upload, nil
+}
+
+func (self *Handler) createMultipartUpload(w http.ResponseWriter, r *http.Request, bucket string, key string) error {
+	_, err := self.bucket(bucket)
+	if err != nil {
+		return err
+	}
+
+	random := make([]byte, 16)
+
+	_, err = rand.Read(random)
+	if err != nil {
+		return err
+	}
+
+	id := hex.EncodeToString(random)
+
+	self.lock.Lock()
+	self.expireUploads()
+	self.uploads[id] = &multipartUpload{
+		bucket:      bucket,
+		key:         key,
+		modTime:     modTime(r.Header),
+		contentType: r.Header.Get("Content-Type"),
+		created:     time.Now(),
+		parts:       map[int]*uploadPart{},
+	}
+	self.lock.Unlock()
+
+	writeXML(w, http.StatusOK, &initiateMultipartUploadResult{
+		Xmlns:    xmlNamespace,
+		Bucket:   bucket,
+		Key:      key,
+		UploadID: id,
+	})
+
+	return nil
+}
+
+func (self *Handler) uploadPart(w http.ResponseWriter, r *http.Request, bucket string, key string) error {
+	_, upload, err := self.upload(r, bucket, key)
+	if err != nil {
+		return err
+	}
+
+	number, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || number < 1 || number > maxPartNumber {
+		return errInvalidArgument
+	}
+
+	file, err := os.CreateTemp(self.spoolDir, "proton-drive-s3-*")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	hash := md5.New()
+
+	_, err = io.Copy(io.MultiWriter(file, hash), r.Body)
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return err
+	}
+
+	part := &uploadPart{
+		path: file.Name(),
+		hash: hash.Sum(nil),
+	}
+
+	part.etag = `"` + hex.EncodeToString(part.hash) + `"`
+
+	upload.lock.Lock()
+	defer upload.lock.Unlock()
+
+	// The upload was aborted or expired while the part was received
+	if upload.done {
+		_ = os.Remove(part.path)
+		return errNoSuchUpload
+	}
+
+	if old, ok := upload.parts[number]; ok {
+		_ = os.Remove(old.path)
+	}
+
+	upload.parts[number] = part
+
+	w.Header().Set("ETag", part.etag)
+	w.WriteHeader(http.StatusOK)
+
+	return nil
+}
+
+func (self *Handler) completeMultipartUpload(w http.ResponseWriter, r *http.Request, bucket string, key string) error {
+	id, upload, err := self.upload(r, bucket, key)
+	if err != nil {
+		return err
+	}
+
+	request := &completeMultipartUploadRequest{}
+
+	err = xml.NewDecoder(r.Body).Decode(request)
+	if err != nil || len(request.Parts) == 0 {
+		return errMalformedXML
+	}
+
+	upload.lock.Lock()
+	defer upload.lock.Unlock()
+
+	if upload.done {
+		return errNoSuchUpload
+	}
+
+	parts := []*uploadPart{}
+	hashes := []byte{}
+
+	for i, requested := range request.Parts {
+		if i > 0 && requested.PartNumber <= request.Parts[i-1].PartNumber {
+			return errInvalidPartOrder
+		}
+
+		part, ok := upload.parts[requested.PartNumber]
+		if !ok || strings.Trim(requested.ETag, `"`) != strings.Trim(part.etag, `"`) {
+			return errInvalidPart
+		}
+
+		parts = append(parts, part)
+		hashes = append(hashes, part.hash...)
+	}
+
+	parent, name, err := self.parentDir(r.Context(), bucket, key)
+	if err != nil {
+		return err
+	}
+
+	opts := []drive.Option{}
+	if upload.contentType != "" && upload.contentType != "binary/octet-stream" {
+		opts = append(opts, drive.WithMIMEType(upload.contentType))
+	}
+
+	writer, err := self.session.FileSystem().Upload(r.Context(), parent, name, opts...)
+	if err != nil {
+		return err
+	}
+
+	writer.SetModTime(upload.modTime)
+
+	for _, part := range parts {
+		err := copyPart(writer, part)
+		if err != nil {
+			_ = writer.Abort()
+			return err
+		}
+	}
+
+	_, err = writer.Commit()
+	if err != nil {
+		_ = writer.Abort()
+		return err
+	}
+
+	self.lock.Lock()
+	delete(self.uploads, id)
+	self.lock.Unlock()
+
+	for _, part := range upload.parts {
+		_ = os.Remove(part.path)
+	}
+
+	upload.done = true
+
+	sum := md5.Sum(hashes)
+
+	writeXML(w, http.StatusOK, &completeMultipartUploadResult{
+		Xmlns:  xmlNamespace,
+		Bucket: bucket,
+		Key:    key,
+		ETag:   fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sum[:]), len(parts)),
+	})
+
+	return nil
+}
+
+func copyPart(writer *drive.FileWriter, part *uploadPart) error {
+	file, err := os.Open(part.path)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	_, err = writer.ReadFrom(file)
+	return err
+}
+
+func (self *Handler) abortMultipartUpload(w http.ResponseWriter, r *http.Request, bucket string, key string) error {
+	id, upload, err := self.upload(r, bucket, key)
+	if err != nil {
+		return err
+	}
+
+	self.lock.Lock()
+	delete(self.uploads, id)
+	self.lock.Unlock()
+
+	upload.cleanup()
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
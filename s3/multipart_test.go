@@ -0,0 +1,129 @@
+package s3
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testUpload(t *testing.T, created time.Time) (*multipartUpload, string) {
+	path := filepath.Join(t.TempDir(), "part")
+
+	err := os.WriteFile(path, []byte("data"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upload := &multipartUpload{
+		created: created,
+		parts:   map[int]*uploadPart{1: {path: path}},
+	}
+
+	return upload, path
+}
+
+func TestExpireUploads(t *testing.T) {
+	old, oldPath := testUpload(t, time.Now().Add(-maxUploadAge-time.Minute))
+	recent, recentPath := testUpload(t, time.Now())
+
+	self := &Handler{uploads: map[string]*multipartUpload{"old": old, "recent": recent}}
+
+	self.lock.Lock()
+	self.expireUploads()
+	self.lock.Unlock()
+
+	if _, ok := self.uploads["old"]; ok {
+		t.Errorf("old upload wasn't expired")
+	}
+
+	if _, ok := self.uploads["recent"]; !ok {
+		t.Errorf("recent upload was expired")
+	}
+
+	// The parts are removed in the background
+	for i := 0; i < 100; i++ {
+		old.lock.Lock()
+		done := old.done
+		old.lock.Unlock()
+
+		if done {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := os.Stat(oldPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("part of the old upload wasn't removed: %v", err)
+	}
+
+	if _, err := os.Stat(recentPath); err != nil {
+		t.Errorf("part of the recent upload was removed: %v", err)
+	}
+}
+
+func TestHandlerClose(t *testing.T) {
+	upload, path := testUpload(t, time.Now())
+
+	self := &Handler{uploads: map[string]*multipartUpload{"upload": upload}}
+
+	err := self.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(self.uploads) != 0 || !upload.done {
+		t.Errorf("upload wasn't removed")
+	}
+
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("part wasn't removed: %v", err)
+	}
+}
+
+func TestAbortMultipartUpload(t *testing.T) {
+	upload, path := testUpload(t, time.Now())
+	upload.bucket = "bucket"
+	upload.key = "dir/file"
+
+	self := &Handler{uploads: map[string]*multipartUpload{"upload": upload}}
+
+	// The upload ID alone isn't enough, it has to belong to the object
+	for _, object := range [][2]string{{"other", "dir/file"}, {"bucket", "dir/other"}} {
+		r := httptest.NewRequest(http.MethodDelete, "/"+object[0]+"/"+object[1]+"?uploadId=upload", nil)
+
+		err := self.abortMultipartUpload(httptest.NewRecorder(), r, object[0], object[1])
+		if err != errNoSuchUpload {
+			t.Errorf("%s/%s: got %v, want %v", object[0], object[1], err, errNoSuchUpload)
+		}
+	}
+
+	if _, err := os.Stat(path); err != nil || upload.done {
+		t.Fatalf("upload was aborted through another object: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodDelete, "/bucket/dir/file?uploadId=upload", nil)
+	w := httptest.NewRecorder()
+
+	err := self.abortMultipartUpload(w, r, "bucket", "dir/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusNoContent)
+	}
+
+	if _, ok := self.uploads["upload"]; ok || !upload.done {
+		t.Errorf("upload wasn't removed")
+	}
+
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("part wasn't removed: %v", err)
+	}
+}
@@ -0,0 +1,262 @@
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+const (
+	// Used by rclone and s3cmd to preserve modification times
+	mtimeHeader = "X-Amz-Meta-Mtime"
+)
+
+func etag(link *drive.Link) string {
+	if link.ContentHash() != "" {
+		return `"` + link.ContentHash() + `"`
+	}
+
+	return `"` + link.RevisionID() + `"`
+}
+
+func setObjectHeaders(w http.ResponseWriter, link *drive.Link) {
+	w.Header().Set("ETag", etag(link))
+	w.Header().Set("Last-Modified", link.ModificationTime().UTC().Format(http.TimeFormat))
+	w.Header().Set(mtimeHeader, strconv.FormatInt(link.ModificationTime().Unix(), 10))
+
+	if link.MIMEType() != "" {
+		w.Header().Set("Content-Type", link.MIMEType())
+	}
+}
+
+func (self *Handler) getObject(w http.ResponseWriter, r *http.Request, bucket string, key string) error {
+	link, err := self.object(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	reader, err := self.session.FileSystem().Download(r.Context(), link)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	setObjectHeaders(w, link)
+	http.ServeContent(w, r, link.Name(), link.ModificationTime(), reader)
+
+	return nil
+}
+
+func (self *Handler) headObject(w http.ResponseWriter, r *http.Request, bucket string, key string) error {
+	link, err := self.object(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	setObjectHeaders(w, link)
+
+	// ServeContent evaluates the conditional and range headers, and doesn't read anything for HEAD requests
+	http.ServeContent(w, r, link.Name(), link.ModificationTime(), &sizeSeeker{size: link.Size()})
+
+	return nil
+}
+
+func (self *Handler) putObject(w http.ResponseWriter, r *http.Request, bucket string, key string) error {
+	parent, name, err := self.parentDir(r.Context(), bucket, key)
+	if err != nil {
+		return err
+	}
+
+	// Zero sized keys ending in a slash are used by many clients to create folders
+	if strings.HasSuffix(key, "/") {
+		_, err := self.mkdir(r.Context(), parent, name)
+		if err != nil {
+			return err
+		}
+
+		w.Header().Set("ETag", `"`+hex.EncodeToString(md5.New().Sum(nil))+`"`)
+		w.WriteHeader(http.StatusOK)
+
+		return nil
+	}
+
+	opts := []drive.Option{}
+
+	if r.Header.Get("If-None-Match") == "*" {
+		opts = append(opts, drive.WithCreateMode(drive.CreateExclusive))
+	}
+
+	if contentType := r.Header.Get("Content-Type"); contentType != "" && contentType != "binary/octet-stream" {
+		opts = append(opts, drive.WithMIMEType(contentType))
+	}
+
+	writer, err := self.session.FileSystem().Upload(r.Context(), parent, name, opts...)
+	if err != nil {
+		return err
+	}
+
+	writer.SetModTime(modTime(r.Header))
+
+	hash := md5.New()
+
+	_, err = writer.ReadFrom(io.TeeReader(r.Body, hash))
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Commit()
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("ETag", `"`+hex.EncodeToString(hash.Sum(nil))+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	return nil
+}
+
+func (self *Handler) copyObject(w http.ResponseWriter, r *http.Request, bucket string, key string) error {
+	source, err := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		return errInvalidArgument
+	}
+
+	source, _, _ = strings.Cut(source, "?")
+	srcBucket, srcKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+
+	src, err := self.object(srcBucket, srcKey)
+	if err != nil {
+		return err
+	}
+
+	parent, name, err := self.parentDir(r.Context(), bucket, key)
+	if err != nil {
+		return err
+	}
+
+	reader, err := self.session.FileSystem().Download(r.Context(), src)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	writer, err := self.session.FileSystem().Upload(r.Context(), parent, name, drive.WithMIMEType(src.MIMEType()))
+	if err != nil {
+		return err
+	}
+
+	if r.Header.Get("X-Amz-Metadata-Directive") == "REPLACE" {
+		writer.SetModTime(modTime(r.Header))
+	} else {
+		writer.SetModTime(src.ModificationTime())
+	}
+
+	_, err = writer.ReadFrom(reader)
+	if err != nil {
+		return err
+	}
+
+	link, err := writer.Commit()
+	if err != nil {
+		return err
+	}
+
+	writeXML(w, http.StatusOK, &copyObjectResult{
+		Xmlns:        xmlNamespace,
+		LastModified: formatTime(link.ModificationTime()),
+		ETag:         etag(link),
+	})
+
+	return nil
+}
+
+func (self *Handler) deleteObject(w http.ResponseWriter, r *http.Request, bucket string, key string) error {
+	err := self.delete(r, bucket, key)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// delete removes a key. Like S3, deleting a key that doesn't exist isn't an error.
+func (self *Handler) delete(r *http.Request, bucket string, key string) error {
+	root, err := self.bucket(bucket)
+	if err != nil {
+		return err
+	}
+
+	err = checkKey(key)
+	if err != nil {
+		return err
+	}
+
+	link := self.session.Links().LinkFromPath(root.Path() + "/" + strings.Trim(key, "/"))
+	if link == nil || link == root {
+		return nil
+	}
+
+	// Folders are only removed through their marker keys, and only if they are empty
+	if link.IsDir() && (!strings.HasSuffix(key, "/") || link.Children().Cardinality() > 0) {
+		return nil
+	}
+
+	err = self.session.FileSystem().Delete(r.Context(), link)
+	if errors.Is(err, drive.ErrInvalidLink) {
+		return nil
+	}
+
+	return err
+}
+
+func modTime(header http.Header) time.Time {
+	value := header.Get(mtimeHeader)
+	if value == "" {
+		return time.Now()
+	}
+
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return time.Now()
+	}
+
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+// sizeSeeker is an empty io.ReadSeeker that only reports its size.
+type sizeSeeker struct {
+	size   int64
+	offset int64
+}
+
+func (self *sizeSeeker) Read(_ []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (self *sizeSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		self.offset = offset
+	case io.SeekCurrent:
+		self.offset += offset
+	case io.SeekEnd:
+		self.offset = self.size + offset
+	}
+
+	return self.offset, nil
+}
@@ -0,0 +1,247 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	pathlib "path"
+	"strings"
+	"sync"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+// Handler is an S3 compatible HTTP server on top of a drive session. Buckets map to the folders at the root of the
+// link tree, and keys to the paths inside of them. Only path-style requests are supported.
+type Handler struct {
+	//
+	// PARAMETERS
+	//
+
+	session     *drive.Session
+	credentials map[string]string
+	spoolDir    string
+
+	//
+	// INTERNAL STATE
+	//
+
+	uploads map[string]*multipartUpload
+	lock    sync.Mutex
+}
+
+// NewHandler returns an S3 handler that authenticates requests against the given access key ID / secret key pairs.
+func NewHandler(session *drive.Session, credentials map[string]string) *Handler {
+	return &Handler{
+		session:     session,
+		credentials: credentials,
+		spoolDir:    os.TempDir(),
+		uploads:     map[string]*multipartUpload{},
+	}
+}
+
+// SetSpoolDir sets the directory where parts of multipart uploads are stored until the upload is completed.
+func (self *Handler) SetSpoolDir(dir string) {
+	self.spoolDir = dir
+}
+
+func (self *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := self.authenticate(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	if bucket == "" {
+		err = self.serveService(w, r)
+	} else if key == "" {
+		err = self.serveBucket(w, r, bucket)
+	} else {
+		err = self.serveObject(w, r, bucket, key)
+	}
+
+	if err != nil {
+		writeError(w, r, err)
+	}
+}
+
+func (self *Handler) serveService(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return errMethodNotAllowed
+	}
+
+	return self.listBuckets(w)
+}
+
+func (self *Handler) serveBucket(w http.ResponseWriter, r *http.Request, bucket string) error {
+	query := r.URL.Query()
+
+	switch r.Method {
+	case http.MethodGet:
+		switch {
+		case query.Has("location"):
+			return self.getBucketLocation(w, bucket)
+		case query.Has("uploads"), query.Has("versioning"), query.Has("policy"), query.Has("acl"):
+			return errNotImplemented
+		case query.Get("list-type") == "2":
+			return self.listObjects(w, r, bucket, true)
+		}
+
+		return self.listObjects(w, r, bucket, false)
+	case http.MethodHead:
+		_, err := self.bucket(bucket)
+		if err != nil {
+			return err
+		}
+
+		w.WriteHeader(http.StatusOK)
+		return nil
+	case http.MethodPut:
+		return self.createBucket(w, r, bucket)
+	case http.MethodDelete:
+		return self.deleteBucket(w, r, bucket)
+	case http.MethodPost:
+		if query.Has("delete") {
+			return self.deleteObjects(w, r, bucket)
+		}
+	}
+
+	return errMethodNotAllowed
+}
+
+func (self *Handler) serveObject(w http.ResponseWriter, r *http.Request, bucket string, key string) error {
+	query := r.URL.Query()
+
+	switch r.Method {
+	case http.MethodGet:
+		return self.getObject(w, r, bucket, key)
+	case http.MethodHead:
+		return self.headObject(w, r, bucket, key)
+	case http.MethodPut:
+		if query.Has("uploadId") {
+			return self.uploadPart(w, r, bucket, key)
+		}
+
+		if r.Header.Get("X-Amz-Copy-Source") != "" {
+			return self.copyObject(w, r, bucket, key)
+		}
+
+		return self.putObject(w, r, bucket, key)
+	case http.MethodDelete:
+		if query.Has("uploadId") {
+			return self.abortMultipartUpload(w, r, bucket, key)
+		}
+
+		return self.deleteObject(w, r, bucket, key)
+	case http.MethodPost:
+		if query.Has("uploads") {
+			return self.createMultipartUpload(w, r, bucket, key)
+		}
+
+		if query.Has("uploadId") {
+			return self.completeMultipartUpload(w, r, bucket, key)
+		}
+	}
+
+	return errMethodNotAllowed
+}
+
+//
+// Path handling
+//
+
+func (self *Handler) bucket(name string) (*drive.Link, error) {
+	if name == "" || name == "." || name == ".." {
+		return nil, errInvalidBucketName
+	}
+
+	link := self.session.Links().LinkFromPath(pathlib.Join("/", name))
+	if link == nil || !link.IsDir() {
+		return nil, errNoSuchBucket
+	}
+
+	return link, nil
+}
+
+// checkKey rejects keys with "." or ".." segments. Paths are cleaned when they are looked up, so those keys could
+// point to another key, or outside of the bucket.
+func checkKey(key string) error {
+	for _, name := range strings.Split(key, "/") {
+		if name == "." || name == ".." {
+			return errInvalidArgument
+		}
+	}
+
+	return nil
+}
+
+func (self *Handler) object(bucket string, key string) (*drive.Link, error) {
+	root, err := self.bucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	link := self.session.Links().LinkFromPath(pathlib.Join(root.Path(), key))
+	if link == nil || !link.IsFile() {
+		return nil, errNoSuchKey
+	}
+
+	return link, nil
+}
+
+// parentDir returns the folder that a key will be stored in, creating any missing folders along the way.
+func (self *Handler) parentDir(ctx context.Context, bucket string, key string) (*drive.Link, string, error) {
+	parent, err := self.bucket(bucket)
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = checkKey(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	parts := strings.Split(strings.Trim(key, "/"), "/")
+
+	for _, name := range parts[:len(parts)-1] {
+		parent, err = self.mkdir(ctx, parent, name)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	return parent, parts[len(parts)-1], nil
+}
+
+func (self *Handler) mkdir(ctx context.Context, parent *drive.Link, name string) (*drive.Link, error) {
+	if name == "" || name == "." || name == ".." {
+		return nil, errInvalidArgument
+	}
+
+	existing := self.session.Links().LinkFromPath(pathlib.Join(parent.Path(), name))
+	if existing != nil {
+		if !existing.IsDir() {
+			return nil, errInvalidArgument
+		}
+
+		return existing, nil
+	}
+
+	link, err := self.session.FileSystem().CreateDir(ctx, parent, name)
+	if errors.Is(err, drive.ErrAlreadyExists) {
+		existing = self.session.Links().LinkFromPath(pathlib.Join(parent.Path(), name))
+		if existing != nil {
+			return existing, nil
+		}
+	}
+
+	return link, err
+}
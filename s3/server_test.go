@@ -0,0 +1,22 @@
+package s3
+
+import (
+	"testing"
+)
+
+func TestCheckKey(t *testing.T) {
+	valid := []string{"file.txt", "dir/file.txt", "dir/", "..file", "dir/.hidden", "a..b/c"}
+	invalid := []string{"..", "../other/file.txt", "dir/../../other", "./file.txt", "dir/./file.txt", "dir/.."}
+
+	for _, key := range valid {
+		if err := checkKey(key); err != nil {
+			t.Errorf("%q: unexpected error %v", key, err)
+		}
+	}
+
+	for _, key := range invalid {
+		if err := checkKey(key); err == nil {
+			t.Errorf("%q: accepted", key)
+		}
+	}
+}
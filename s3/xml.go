@@ -0,0 +1,238 @@
+package s3
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"time"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+const (
+	xmlNamespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+)
+
+type apiError struct {
+	status  int
+	code    string
+	message string
+}
+
+var (
+	errNoSuchBucket   = &apiError{http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist."}
+	errNoSuchKey      = &apiError{http.StatusNotFound, "NoSuchKey", "The specified key does not exist."}
+	errNoSuchUpload   = &apiError{http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist."}
+	errBucketExists   = &apiError{http.StatusConflict, "BucketAlreadyOwnedByYou", "The bucket already exists."}
+	errBucketNotEmpty = &apiError{
+		http.StatusConflict, "BucketNotEmpty", "The bucket you tried to delete is not empty.",
+	}
+	errInvalidBucketName = &apiError{http.StatusBadRequest, "InvalidBucketName", "The specified bucket is not valid."}
+	errInvalidArgument   = &apiError{http.StatusBadRequest, "InvalidArgument", "Invalid argument."}
+	errInvalidPart       = &apiError{
+		http.StatusBadRequest, "InvalidPart", "One or more of the parts could not be found.",
+	}
+	errInvalidPartOrder = &apiError{http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in order."}
+	errMalformedXML     = &apiError{
+		http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed.",
+	}
+	errNotImplemented     = &apiError{http.StatusNotImplemented, "NotImplemented", "Not implemented."}
+	errMethodNotAllowed   = &apiError{http.StatusMethodNotAllowed, "MethodNotAllowed", "Method not allowed."}
+	errAccessDenied       = &apiError{http.StatusForbidden, "AccessDenied", "Access Denied."}
+	errInvalidAccessKeyID = &apiError{http.StatusForbidden, "InvalidAccessKeyId", "The access key does not exist."}
+	errSignatureMismatch  = &apiError{http.StatusForbidden, "SignatureDoesNotMatch", "The signature does not match."}
+	errRequestExpired     = &apiError{http.StatusForbidden, "RequestTimeTooSkewed", "The request time is too skewed."}
+	errBadDigest          = &apiError{
+		http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The content hash mismatches.",
+	}
+	errPreconditionFailed = &apiError{http.StatusPreconditionFailed, "PreconditionFailed", "Precondition failed."}
+	errInternal           = &apiError{http.StatusInternalServerError, "InternalError", "Internal error."}
+)
+
+// toAPIError maps errors from authentication and the drive library onto S3 error codes.
+func toAPIError(err error) *apiError {
+	var out *apiError
+
+	switch {
+	case errors.As(err, &out):
+		return out
+	case errors.Is(err, ErrAccessDenied), errors.Is(err, ErrAuthorizationInvalid):
+		return errAccessDenied
+	case errors.Is(err, ErrInvalidAccessKeyID):
+		return errInvalidAccessKeyID
+	case errors.Is(err, ErrSignatureDoesNotMatch), errors.Is(err, ErrChunkSignatureInvalid):
+		return errSignatureMismatch
+	case errors.Is(err, ErrRequestExpired):
+		return errRequestExpired
+	case errors.Is(err, ErrContentSHA256Mismatch):
+		return errBadDigest
+	case errors.Is(err, drive.ErrInvalidLink):
+		return errNoSuchKey
+	case errors.Is(err, drive.ErrAlreadyExists), errors.Is(err, drive.ErrRevisionConflict):
+		return errPreconditionFailed
+	case errors.Is(err, drive.ErrReadOnly), errors.Is(err, drive.ErrMountPoint):
+		return errAccessDenied
+	}
+
+	return &apiError{http.StatusInternalServerError, errInternal.code, err.Error()}
+}
+
+func (self *apiError) Error() string {
+	return self.code + ": " + self.message
+}
+
+type errorResponse struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string   `xml:"Code"`
+	Message  string   `xml:"Message"`
+	Resource string   `xml:"Resource"`
+}
+
+type owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+type bucket struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type listBucketsResult struct {
+	XMLName xml.Name `xml:"ListAllMyBucketsResult"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Owner   owner    `xml:"Owner"`
+	Buckets []bucket `xml:"Buckets>Bucket"`
+}
+
+type object struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type listBucketResult struct {
+	XMLName xml.Name `xml:"ListBucketResult"`
+	Xmlns   string   `xml:"xmlns,attr"`
+
+	Name         string `xml:"Name"`
+	Prefix       string `xml:"Prefix"`
+	Delimiter    string `xml:"Delimiter,omitempty"`
+	MaxKeys      int    `xml:"MaxKeys"`
+	IsTruncated  bool   `xml:"IsTruncated"`
+	EncodingType string `xml:"EncodingType,omitempty"`
+
+	// ListObjects
+	Marker     *string `xml:"Marker"`
+	NextMarker string  `xml:"NextMarker,omitempty"`
+
+	// ListObjectsV2
+	KeyCount              *int   `xml:"KeyCount"`
+	StartAfter            string `xml:"StartAfter,omitempty"`
+	ContinuationToken     string `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string `xml:"NextContinuationToken,omitempty"`
+
+	Contents       []object       `xml:"Contents"`
+	CommonPrefixes []commonPrefix `xml:"CommonPrefixes"`
+}
+
+type locationConstraint struct {
+	XMLName xml.Name `xml:"LocationConstraint"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Value   string   `xml:",chardata"`
+}
+
+type copyObjectResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	Xmlns        string   `xml:"xmlns,attr"`
+	LastModified string   `xml:"LastModified"`
+	ETag         string   `xml:"ETag"`
+}
+
+type deleteRequest struct {
+	XMLName xml.Name `xml:"Delete"`
+	Quiet   bool     `xml:"Quiet"`
+	Objects []struct {
+		Key string `xml:"Key"`
+	} `xml:"Object"`
+}
+
+type deletedObject struct {
+	Key string `xml:"Key"`
+}
+
+type deleteError struct {
+	Key     string `xml:"Key"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name        `xml:"DeleteResult"`
+	Xmlns   string          `xml:"xmlns,attr"`
+	Deleted []deletedObject `xml:"Deleted"`
+	Errors  []deleteError   `xml:"Error"`
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+type completeMultipartUploadRequest struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Bucket  string   `xml:"Bucket"`
+	Key     string   `xml:"Key"`
+	ETag    string   `xml:"ETag"`
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+func writeXML(w http.ResponseWriter, status int, value any) {
+	data, err := xml.Marshal(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr := toAPIError(err)
+
+	if r.Method == http.MethodHead {
+		w.WriteHeader(apiErr.status)
+		return
+	}
+
+	writeXML(w, apiErr.status, &errorResponse{
+		Code:     apiErr.code,
+		Message:  apiErr.message,
+		Resource: r.URL.Path,
+	})
+}
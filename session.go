@@ -52,6 +52,11 @@ func (self *Session) FileSystem() *FileSystem {
 	return self.fs
 }
 
+// FS returns an io/fs view of the link tree. Files are downloaded using the given context.
+func (self *Session) FS(ctx context.Context) *FS {
+	return &FS{ctx: ctx, links: self.Links(), fs: self.FileSystem()}
+}
+
 func (self *Session) Init(ctx context.Context) error {
 	err := self.user.Init(ctx)
 	if err != nil {
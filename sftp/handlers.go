@@ -0,0 +1,358 @@
+package sftp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	pathlib "path"
+	"sort"
+	"sync"
+
+	drive "github.com/StollD/proton-drive"
+	sftplib "github.com/pkg/sftp"
+)
+
+// Writes that arrive ahead of a missing one are kept in memory, up to this size. Clients only pipeline a few dozen
+// writes of 32 KiB.
+const maxPendingSize = 4 * drive.BlockSize
+
+var (
+	ErrWriteGap = errors.New("write leaves a gap in the file")
+)
+
+var _ sftplib.FileReader = &handlers{}
+var _ sftplib.FileWriter = &handlers{}
+var _ sftplib.FileCmder = &handlers{}
+var _ sftplib.FileLister = &handlers{}
+
+// handlers map SFTP requests onto the link tree and the drive file system.
+type handlers struct {
+	session *drive.Session
+}
+
+// NewHandlers returns the SFTP request handlers for a session.
+func NewHandlers(session *drive.Session) sftplib.Handlers {
+	h := &handlers{session: session}
+
+	return sftplib.Handlers{
+		FileGet:  h,
+		FilePut:  h,
+		FileCmd:  h,
+		FileList: h,
+	}
+}
+
+func (self *handlers) link(path string) (*drive.Link, error) {
+	link := self.session.Links().LinkFromPath(pathlib.Join("/", path))
+	if link == nil {
+		return nil, os.ErrNotExist
+	}
+
+	return link, nil
+}
+
+func (self *handlers) parent(path string) (*drive.Link, string, error) {
+	path = pathlib.Join("/", path)
+
+	parent, err := self.link(pathlib.Dir(path))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !parent.IsDir() {
+		return nil, "", os.ErrInvalid
+	}
+
+	return parent, pathlib.Base(path), nil
+}
+
+func (self *handlers) Fileread(r *sftplib.Request) (io.ReaderAt, error) {
+	link, err := self.link(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	if !link.IsFile() {
+		return nil, os.ErrInvalid
+	}
+
+	reader, err := self.session.FileSystem().Download(r.Context(), link)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	return &readerAt{reader: reader}, nil
+}
+
+func (self *handlers) Filewrite(r *sftplib.Request) (io.WriterAt, error) {
+	flags := r.Pflags()
+
+	link, err := self.link(r.Filepath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if link != nil && link.IsDir() {
+		return nil, os.ErrInvalid
+	}
+
+	if link != nil && flags.Creat && flags.Excl {
+		return nil, os.ErrExist
+	}
+
+	// Appending or rewriting parts of a file would require downloading it first
+	if link != nil && (flags.Append || !flags.Trunc) {
+		return nil, sftplib.ErrSSHFxOpUnsupported
+	}
+
+	parent, name, err := self.parent(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []drive.Option{}
+	if flags.Excl {
+		opts = append(opts, drive.WithCreateMode(drive.CreateExclusive))
+	}
+
+	// The request context is canceled when the handle is closed, but the upload is only committed after that
+	writer, err := self.session.FileSystem().Upload(context.Background(), parent, name, opts...)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	return &writerAt{writer: writer, pending: map[int64][]byte{}}, nil
+}
+
+func (self *handlers) Filecmd(r *sftplib.Request) error {
+	fs := self.session.FileSystem()
+
+	switch r.Method {
+	case "Setstat":
+		// Attributes can only be changed by uploading a new revision
+		return nil
+	case "Rename":
+		link, err := self.link(r.Filepath)
+		if err != nil {
+			return err
+		}
+
+		parent, name, err := self.parent(r.Target)
+		if err != nil {
+			return err
+		}
+
+		_, err = fs.Move(r.Context(), link, parent, name)
+		return convertError(err)
+	case "Rmdir":
+		link, err := self.link(r.Filepath)
+		if err != nil {
+			return err
+		}
+
+		if !link.IsDir() || link.IsRoot() {
+			return os.ErrInvalid
+		}
+
+		if link.Children().Cardinality() > 0 {
+			return sftplib.ErrSSHFxFailure
+		}
+
+		return convertError(fs.Delete(r.Context(), link))
+	case "Remove":
+		link, err := self.link(r.Filepath)
+		if err != nil {
+			return err
+		}
+
+		if !link.IsFile() {
+			return os.ErrInvalid
+		}
+
+		return convertError(fs.Delete(r.Context(), link))
+	case "Mkdir":
+		parent, name, err := self.parent(r.Filepath)
+		if err != nil {
+			return err
+		}
+
+		_, err = fs.CreateDir(r.Context(), parent, name)
+		return convertError(err)
+	}
+
+	return sftplib.ErrSSHFxOpUnsupported
+}
+
+func (self *handlers) Filelist(r *sftplib.Request) (sftplib.ListerAt, error) {
+	link, err := self.link(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	switch r.Method {
+	case "List":
+		if !link.IsDir() {
+			return nil, os.ErrInvalid
+		}
+
+		children := link.Children().ToSlice()
+
+		sort.Slice(children, func(i, j int) bool {
+			return children[i].Name() < children[j].Name()
+		})
+
+		out := make(listerAt, len(children))
+		for i, child := range children {
+			out[i] = child
+		}
+
+		return out, nil
+	case "Stat":
+		return listerAt{link}, nil
+	}
+
+	return nil, sftplib.ErrSSHFxOpUnsupported
+}
+
+func convertError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, drive.ErrInvalidLink):
+		return os.ErrNotExist
+	case errors.Is(err, drive.ErrAlreadyExists):
+		return os.ErrExist
+	case errors.Is(err, drive.ErrInvalidLinkType):
+		return os.ErrInvalid
+	case errors.Is(err, drive.ErrReadOnly), errors.Is(err, drive.ErrMountPoint):
+		return os.ErrPermission
+	}
+
+	return err
+}
+
+type listerAt []os.FileInfo
+
+func (self listerAt) ListAt(buffer []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(self)) {
+		return 0, io.EOF
+	}
+
+	n := copy(buffer, self[offset:])
+	if n+int(offset) == len(self) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// readerAt serializes the concurrent reads of an SFTP client onto a seekable FileReader.
+type readerAt struct {
+	reader *drive.FileReader
+	lock   sync.Mutex
+}
+
+func (self *readerAt) ReadAt(buffer []byte, offset int64) (int, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	_, err := self.reader.Seek(offset, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.ReadFull(self.reader, buffer)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+func (self *readerAt) Close() error {
+	return self.reader.Close()
+}
+
+// writerAt reorders the concurrent, pipelined writes of an SFTP client so they can be streamed into a FileWriter.
+type writerAt struct {
+	writer *drive.FileWriter
+
+	offset  int64
+	pending map[int64][]byte
+	failed  bool
+
+	// The size of the pending writes, which are kept in memory
+	pendingSize int
+
+	lock sync.Mutex
+}
+
+var _ sftplib.TransferError = &writerAt{}
+
+func (self *writerAt) WriteAt(buffer []byte, offset int64) (int, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.failed {
+		return 0, sftplib.ErrSSHFxFailure
+	}
+
+	if offset < self.offset {
+		return 0, sftplib.ErrSSHFxOpUnsupported
+	}
+
+	self.pendingSize += len(buffer) - len(self.pending[offset])
+
+	if self.pendingSize > maxPendingSize {
+		self.failed = true
+		return 0, sftplib.ErrSSHFxFailure
+	}
+
+	// The buffer is reused by the server once we return
+	self.pending[offset] = append([]byte{}, buffer...)
+
+	for {
+		data, ok := self.pending[self.offset]
+		if !ok {
+			break
+		}
+
+		delete(self.pending, self.offset)
+		self.pendingSize -= len(data)
+
+		_, err := self.writer.Write(data)
+		if err != nil {
+			self.failed = true
+			return 0, err
+		}
+
+		self.offset += int64(len(data))
+	}
+
+	return len(buffer), nil
+}
+
+func (self *writerAt) TransferError(_ error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.failed = true
+}
+
+func (self *writerAt) Close() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.failed {
+		_ = self.writer.Abort()
+		return sftplib.ErrSSHFxFailure
+	}
+
+	if len(self.pending) > 0 {
+		_ = self.writer.Abort()
+		return ErrWriteGap
+	}
+
+	return self.writer.Close()
+}
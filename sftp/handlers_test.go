@@ -0,0 +1,68 @@
+package sftp
+
+import (
+	"errors"
+	"testing"
+
+	drive "github.com/StollD/proton-drive"
+	sftplib "github.com/pkg/sftp"
+)
+
+func TestWriterAtReorders(t *testing.T) {
+	self := &writerAt{writer: &drive.FileWriter{}, pending: map[int64][]byte{}}
+
+	writes := []struct {
+		offset int64
+		data   string
+	}{
+		{6, "world"},
+		{5, " "},
+		{0, "hello"},
+	}
+
+	for _, write := range writes {
+		n, err := self.WriteAt([]byte(write.data), write.offset)
+		if err != nil || n != len(write.data) {
+			t.Fatalf("write at %d: %d, %v", write.offset, n, err)
+		}
+	}
+
+	if self.offset != 11 || len(self.pending) != 0 || self.pendingSize != 0 {
+		t.Errorf("writes weren't flushed: offset %d, %d pending", self.offset, self.pendingSize)
+	}
+
+	if size := self.writer.Size(); size != 11 {
+		t.Errorf("got %d bytes written, want 11", size)
+	}
+}
+
+func TestWriterAtPendingLimit(t *testing.T) {
+	self := &writerAt{writer: &drive.FileWriter{}, pending: map[int64][]byte{}}
+
+	buffer := make([]byte, 32*1024)
+	offset := int64(len(buffer))
+
+	// The first write never arrives, so everything after it stays pending
+	for ; self.pendingSize+len(buffer) <= maxPendingSize; offset += int64(len(buffer)) {
+		_, err := self.WriteAt(buffer, offset)
+		if err != nil {
+			t.Fatalf("write at %d: %v", offset, err)
+		}
+	}
+
+	// Rewriting a pending range doesn't count twice
+	_, err := self.WriteAt(buffer, int64(len(buffer)))
+	if err != nil {
+		t.Fatalf("rewrite: %v", err)
+	}
+
+	_, err = self.WriteAt(buffer, offset)
+	if !errors.Is(err, sftplib.ErrSSHFxFailure) {
+		t.Errorf("got %v, want %v", err, sftplib.ErrSSHFxFailure)
+	}
+
+	_, err = self.WriteAt(buffer, 0)
+	if !errors.Is(err, sftplib.ErrSSHFxFailure) {
+		t.Errorf("write after failure: got %v, want %v", err, sftplib.ErrSSHFxFailure)
+	}
+}
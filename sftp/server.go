@@ -0,0 +1,159 @@
+package sftp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+
+	drive "github.com/StollD/proton-drive"
+	sftplib "github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	ErrNoAuthorizedKeys = errors.New("no authorized keys")
+	ErrUnauthorizedKey  = errors.New("public key not authorized")
+)
+
+// Server serves the link tree of a session to SFTP clients (sftp, scp, sshfs). Clients are authenticated with
+// public keys; no shell or other channels are offered.
+type Server struct {
+	//
+	// PARAMETERS
+	//
+
+	session *drive.Session
+	config  *ssh.ServerConfig
+}
+
+// NewServer creates an SFTP server using the given SSH host key and authorized_keys files.
+func NewServer(session *drive.Session, hostKeyPath string, authorizedKeysPath string) (*Server, error) {
+	authorized, err := loadAuthorizedKeys(authorizedKeysPath)
+	if err != nil {
+		return nil, err
+	}
+
+	hostKeyData, err := os.ReadFile(hostKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	hostKey, err := ssh.ParsePrivateKey(hostKeyData)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if !authorized[string(key.Marshal())] {
+				return nil, ErrUnauthorizedKey
+			}
+
+			return &ssh.Permissions{}, nil
+		},
+	}
+
+	config.AddHostKey(hostKey)
+
+	return &Server{session: session, config: config}, nil
+}
+
+func loadAuthorizedKeys(path string) (map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	out := map[string]bool{}
+
+	for len(data) > 0 {
+		key, _, _, rest, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			break
+		}
+
+		out[string(key.Marshal())] = true
+		data = rest
+	}
+
+	if len(out) == 0 {
+		return nil, ErrNoAuthorizedKeys
+	}
+
+	return out, nil
+}
+
+// Serve accepts connections on the listener until the context is canceled.
+func (self *Server) Serve(ctx context.Context, listener net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		go self.handleConn(conn)
+	}
+}
+
+func (self *Server) handleConn(conn net.Conn) {
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, self.config)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+
+	defer func() {
+		_ = serverConn.Close()
+	}()
+
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+
+		go self.handleSession(channel, requests)
+	}
+}
+
+func (self *Server) handleSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer func() {
+		_ = channel.Close()
+	}()
+
+	for request := range requests {
+		// The payload of a subsystem request is the name as an SSH string
+		ok := request.Type == "subsystem" && len(request.Payload) > 4 && string(request.Payload[4:]) == "sftp"
+
+		if request.WantReply {
+			_ = request.Reply(ok, nil)
+		}
+
+		if !ok {
+			continue
+		}
+
+		server := sftplib.NewRequestServer(channel, NewHandlers(self.session))
+		_ = server.Serve()
+		_ = server.Close()
+
+		return
+	}
+}
@@ -1,6 +1,8 @@
 package drive
 
 import (
+	"time"
+
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
 	"github.com/henrybear327/go-proton-api"
 )
@@ -9,6 +11,15 @@ type Share struct {
 	share   proton.Share
 	address *Address
 	keyring *crypto.KeyRing
+
+	// The name of the root link, before it was mounted
+	name string
+
+	// Created by another user
+	foreign bool
+
+	// Why the signature of the share passphrase couldn't be verified
+	signatureErr error
 }
 
 func (self *Share) ID() string {
@@ -26,3 +37,37 @@ func (self *Share) Address() *Address {
 func (self *Share) Keyring() *crypto.KeyRing {
 	return self.keyring
 }
+
+func (self *Share) VolumeID() string {
+	return self.share.VolumeID
+}
+
+func (self *Share) Type() proton.ShareType {
+	return self.share.Type
+}
+
+// Name returns the name of the share root, which can differ from the name it is mounted under.
+func (self *Share) Name() string {
+	return self.name
+}
+
+func (self *Share) ModificationTime() time.Time {
+	return time.Unix(self.share.ModifyTime, 0)
+}
+
+// Creator returns the email address of the user who created the share.
+func (self *Share) Creator() string {
+	return self.share.Creator
+}
+
+// IsForeign reports whether the share was created by another user, who shared it with this one.
+func (self *Share) IsForeign() bool {
+	return self.foreign
+}
+
+// ReadOnly reports whether the links in the share can only be read. The API client doesn't expose the permissions
+// of share members, so shares of other users are always treated as read-only. The photos share is read-only too,
+// because photos can't be uploaded without their capture time.
+func (self *Share) ReadOnly() bool {
+	return self.foreign || self.Type() == ShareTypePhotos
+}
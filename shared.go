@@ -0,0 +1,54 @@
+package drive
+
+// SharedFolder is a share that another user shared with this one. Invitations have to be accepted in one of the
+// official clients, the API client has no endpoints for them.
+type SharedFolder struct {
+	share *Share
+	root  *Link
+}
+
+func (self *SharedFolder) ID() string {
+	return self.share.ID()
+}
+
+func (self *SharedFolder) Name() string {
+	return self.share.Name()
+}
+
+// Owner returns the email address of the user who shared the folder.
+func (self *SharedFolder) Owner() string {
+	return self.share.Creator()
+}
+
+func (self *SharedFolder) Share() *Share {
+	return self.share
+}
+
+// Root returns the folder the share is mounted as. It can be used with the FileSystem like any other folder.
+func (self *SharedFolder) Root() *Link {
+	return self.root
+}
+
+func (self *SharedFolder) ReadOnly() bool {
+	return self.share.ReadOnly()
+}
+
+// SharedWithMe returns the shares of other users that are mounted in the link tree.
+func (self *Session) SharedWithMe() []*SharedFolder {
+	folders := []*SharedFolder{}
+
+	for _, share := range self.links.Shares() {
+		if !share.IsForeign() {
+			continue
+		}
+
+		root := self.links.LinkFromID(share.LinkID())
+		if root == nil {
+			continue
+		}
+
+		folders = append(folders, &SharedFolder{share: share, root: root})
+	}
+
+	return folders
+}
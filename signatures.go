@@ -0,0 +1,74 @@
+package drive
+
+// SignaturePolicy decides what happens to links whose signatures can't be verified, because they are anonymous, the
+// keys of the signer can't be found, or the signature doesn't match.
+type SignaturePolicy int
+
+const (
+	// The link isn't loaded, which fails the whole tree or share it belongs to
+	SignatureReject SignaturePolicy = iota
+
+	// The link is loaded and marked, and passed to the signature error handlers
+	SignatureWarn
+
+	// The link is loaded and marked
+	SignatureAccept
+)
+
+type SignatureHandler func(link *Link, err error)
+
+// SetSignaturePolicy changes how links with signatures that can't be verified are handled. It has to be called
+// before Init.
+func (self *Links) SetSignaturePolicy(policy SignaturePolicy) {
+	self.signatures = policy
+}
+
+// OnSignatureError registers a handler that is called for every link that was loaded without verified signatures,
+// and for every file whose blocks were read without verified signatures, if the policy is SignatureWarn. Like change
+// handlers, it must not block or modify the tree.
+func (self *Links) OnSignatureError(handler SignatureHandler) {
+	self.update.Lock()
+	defer self.update.Unlock()
+
+	self.onSignatureError = append(self.onSignatureError, handler)
+}
+
+func (self *Links) callOnSignatureError(link *Link) {
+	if self.signatures != SignatureWarn || link.Verified() {
+		return
+	}
+
+	for _, handler := range self.onSignatureError {
+		handler(link, link.SignatureError())
+	}
+}
+
+// checkBlockSignature applies the signature policy to a block of a file whose signature couldn't be verified. It
+// returns the error if the block must not be read.
+func (self *Links) checkBlockSignature(link *Link, err error) error {
+	switch self.signatures {
+	case SignatureReject:
+		return err
+	case SignatureAccept:
+		return nil
+	}
+
+	self.update.Lock()
+	defer self.update.Unlock()
+
+	for _, handler := range self.onSignatureError {
+		handler(link, err)
+	}
+
+	return nil
+}
+
+// callOnSignatureErrorRecursive reports the unverified links below a folder, once the tree is complete and their
+// paths are known.
+func (self *Links) callOnSignatureErrorRecursive(link *Link) {
+	self.callOnSignatureError(link)
+
+	for child := range link.Children().Iter() {
+		self.callOnSignatureErrorRecursive(child)
+	}
+}
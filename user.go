@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/base64"
 	"errors"
+	"sync"
 
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
 	"github.com/henrybear327/go-proton-api"
@@ -11,6 +12,7 @@ import (
 
 var (
 	ErrKeyringUnlockFailed = errors.New("failed to unlock keyring")
+	ErrPublicKeysNotFound  = errors.New("no public keys found for address")
 )
 
 type User struct {
@@ -31,6 +33,10 @@ type User struct {
 	addresses      []*Address
 	addressByID    map[string]*Address
 	addressByEmail map[string]*Address
+
+	// Addresses of other users, nil if they have no keys
+	publicAddresses map[string]*Address
+	publicLock      sync.Mutex
 }
 
 func (self *User) Init(ctx context.Context) error {
@@ -64,6 +70,7 @@ func (self *User) Init(ctx context.Context) error {
 	self.addresses = []*Address{}
 	self.addressByID = map[string]*Address{}
 	self.addressByEmail = map[string]*Address{}
+	self.publicAddresses = map[string]*Address{}
 
 	for _, addr := range addresses {
 		address := &Address{
@@ -102,3 +109,58 @@ func (self *User) AddressFromEmail(email string) *Address {
 
 	return nil
 }
+
+func (self *User) UsedSpace() int64 {
+	return self.user.UsedSpace
+}
+
+func (self *User) MaxSpace() int64 {
+	return self.user.MaxSpace
+}
+
+// PublicAddress returns the address with the given email. For addresses of other users, only the public keys are
+// known. They are fetched once and then cached.
+func (self *User) PublicAddress(ctx context.Context, email string) (*Address, error) {
+	if address := self.AddressFromEmail(email); address != nil {
+		return address, nil
+	}
+
+	if email == "" {
+		return nil, ErrPublicKeysNotFound
+	}
+
+	self.publicLock.Lock()
+	defer self.publicLock.Unlock()
+
+	address, ok := self.publicAddresses[email]
+	if ok && address == nil {
+		return nil, ErrPublicKeysNotFound
+	}
+
+	if ok {
+		return address, nil
+	}
+
+	keys, _, err := self.client.GetPublicKeys(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		self.publicAddresses[email] = nil
+		return nil, ErrPublicKeysNotFound
+	}
+
+	keyring, err := keys.GetKeyRing()
+	if err != nil {
+		return nil, err
+	}
+
+	address = &Address{
+		address: proton.Address{Email: email},
+		keyring: keyring,
+	}
+
+	self.publicAddresses[email] = address
+	return address, nil
+}
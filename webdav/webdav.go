@@ -0,0 +1,414 @@
+package webdav
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	pathlib "path"
+	"sort"
+	"time"
+
+	drive "github.com/StollD/proton-drive"
+	"github.com/StollD/proton-drive/internal/httpauth"
+	dav "golang.org/x/net/webdav"
+)
+
+var (
+	ErrNotSupported = errors.New("operation not supported")
+)
+
+var _ dav.FileSystem = &FileSystem{}
+
+// FileSystem implements the WebDAV file system interface on top of a drive session.
+type FileSystem struct {
+	//
+	// PARAMETERS
+	//
+
+	session *drive.Session
+}
+
+func NewFileSystem(session *drive.Session) *FileSystem {
+	return &FileSystem{session: session}
+}
+
+// NewHandler returns a WebDAV handler for the session. If username is not empty, requests are authenticated using
+// HTTP basic authentication.
+func NewHandler(session *drive.Session, username string, password string) http.Handler {
+	handler := &dav.Handler{
+		FileSystem: NewFileSystem(session),
+		LockSystem: dav.NewMemLS(),
+	}
+
+	if username == "" {
+		return handler
+	}
+
+	return httpauth.Basic(handler, username, password)
+}
+
+func (self *FileSystem) link(name string) (*drive.Link, error) {
+	link := self.session.Links().LinkFromPath(pathlib.Join("/", name))
+	if link == nil {
+		return nil, os.ErrNotExist
+	}
+
+	return link, nil
+}
+
+func (self *FileSystem) parent(name string) (*drive.Link, string, error) {
+	name = pathlib.Join("/", name)
+
+	parent, err := self.link(pathlib.Dir(name))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !parent.IsDir() {
+		return nil, "", os.ErrInvalid
+	}
+
+	return parent, pathlib.Base(name), nil
+}
+
+func (self *FileSystem) Mkdir(ctx context.Context, name string, _ os.FileMode) error {
+	parent, base, err := self.parent(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = self.session.FileSystem().CreateDir(ctx, parent, base)
+	return convertError(err)
+}
+
+func (self *FileSystem) OpenFile(ctx context.Context, name string, flag int, _ os.FileMode) (dav.File, error) {
+	link, err := self.link(name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		if link == nil {
+			return nil, os.ErrNotExist
+		}
+
+		return &readFile{ctx: ctx, fs: self.session.FileSystem(), link: link}, nil
+	}
+
+	if link == nil && flag&os.O_CREATE == 0 {
+		return nil, os.ErrNotExist
+	}
+
+	if link != nil && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0 {
+		return nil, os.ErrExist
+	}
+
+	if link != nil && link.IsDir() {
+		return nil, os.ErrInvalid
+	}
+
+	// Only whole file replacements can be streamed into a new revision
+	if link != nil && flag&os.O_TRUNC == 0 {
+		return nil, ErrNotSupported
+	}
+
+	parent, base, err := self.parent(name)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []drive.Option{}
+	if flag&os.O_EXCL != 0 {
+		opts = append(opts, drive.WithCreateMode(drive.CreateExclusive))
+	}
+
+	writer, err := self.session.FileSystem().Upload(ctx, parent, base, opts...)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	return &writeFile{name: base, writer: writer}, nil
+}
+
+func (self *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	link, err := self.link(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if link.IsRoot() {
+		return os.ErrPermission
+	}
+
+	return convertError(self.session.FileSystem().Delete(ctx, link))
+}
+
+func (self *FileSystem) Rename(ctx context.Context, oldName string, newName string) error {
+	link, err := self.link(oldName)
+	if err != nil {
+		return err
+	}
+
+	parent, base, err := self.parent(newName)
+	if err != nil {
+		return err
+	}
+
+	_, err = self.session.FileSystem().Move(ctx, link, parent, base)
+	return convertError(err)
+}
+
+func (self *FileSystem) Stat(_ context.Context, name string) (os.FileInfo, error) {
+	link, err := self.link(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileInfo{Link: link}, nil
+}
+
+func convertError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, drive.ErrInvalidLink):
+		return os.ErrNotExist
+	case errors.Is(err, drive.ErrAlreadyExists):
+		return os.ErrExist
+	case errors.Is(err, drive.ErrInvalidLinkType):
+		return os.ErrInvalid
+	case errors.Is(err, drive.ErrReadOnly), errors.Is(err, drive.ErrMountPoint):
+		return os.ErrPermission
+	}
+
+	return err
+}
+
+var _ dav.ContentTyper = &fileInfo{}
+var _ dav.ETager = &fileInfo{}
+
+// fileInfo answers PROPFIND requests from the link tree, without downloading any content.
+type fileInfo struct {
+	*drive.Link
+}
+
+func (self *fileInfo) ContentType(_ context.Context) (string, error) {
+	mimeType := self.MIMEType()
+	if mimeType == "" {
+		return "", dav.ErrNotImplemented
+	}
+
+	return mimeType, nil
+}
+
+func (self *fileInfo) ETag(_ context.Context) (string, error) {
+	if !self.IsFile() {
+		return "", dav.ErrNotImplemented
+	}
+
+	return `"` + self.RevisionID() + `"`, nil
+}
+
+var _ dav.File = &readFile{}
+
+type readFile struct {
+	//
+	// PARAMETERS
+	//
+
+	ctx  context.Context
+	fs   *drive.FileSystem
+	link *drive.Link
+
+	//
+	// INTERNAL STATE
+	//
+
+	reader   *drive.FileReader
+	children []fs.FileInfo
+}
+
+func (self *readFile) open() error {
+	if self.reader != nil {
+		return nil
+	}
+
+	if !self.link.IsFile() {
+		return os.ErrInvalid
+	}
+
+	reader, err := self.fs.Download(self.ctx, self.link)
+	if err != nil {
+		return convertError(err)
+	}
+
+	self.reader = reader
+	return nil
+}
+
+func (self *readFile) Read(buffer []byte) (int, error) {
+	err := self.open()
+	if err != nil {
+		return 0, err
+	}
+
+	return self.reader.Read(buffer)
+}
+
+func (self *readFile) Seek(offset int64, whence int) (int64, error) {
+	err := self.open()
+	if err != nil {
+		return 0, err
+	}
+
+	return self.reader.Seek(offset, whence)
+}
+
+func (self *readFile) Readdir(count int) ([]fs.FileInfo, error) {
+	if !self.link.IsDir() {
+		return nil, os.ErrInvalid
+	}
+
+	if self.children == nil {
+		links := self.link.Children().ToSlice()
+
+		sort.Slice(links, func(i, j int) bool {
+			return links[i].Name() < links[j].Name()
+		})
+
+		self.children = make([]fs.FileInfo, len(links))
+		for i, link := range links {
+			self.children[i] = &fileInfo{Link: link}
+		}
+	}
+
+	if count <= 0 {
+		children := self.children
+		self.children = []fs.FileInfo{}
+
+		return children, nil
+	}
+
+	if len(self.children) == 0 {
+		return nil, io.EOF
+	}
+
+	count = min(count, len(self.children))
+
+	children := self.children[:count]
+	self.children = self.children[count:]
+
+	return children, nil
+}
+
+func (self *readFile) Stat() (fs.FileInfo, error) {
+	return &fileInfo{Link: self.link}, nil
+}
+
+func (self *readFile) Write(_ []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (self *readFile) Close() error {
+	if self.reader == nil {
+		return nil
+	}
+
+	return self.reader.Close()
+}
+
+var _ dav.File = &writeFile{}
+var _ io.ReaderFrom = &writeFile{}
+
+type writeFile struct {
+	//
+	// PARAMETERS
+	//
+
+	name   string
+	writer *drive.FileWriter
+
+	//
+	// INTERNAL STATE
+	//
+
+	failed bool
+}
+
+func (self *writeFile) Write(buffer []byte) (int, error) {
+	n, err := self.writer.Write(buffer)
+	if err != nil {
+		self.failed = true
+	}
+
+	return n, err
+}
+
+func (self *writeFile) ReadFrom(reader io.Reader) (int64, error) {
+	n, err := self.writer.ReadFrom(reader)
+	if err != nil {
+		self.failed = true
+	}
+
+	return n, err
+}
+
+func (self *writeFile) Read(_ []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (self *writeFile) Seek(_ int64, _ int) (int64, error) {
+	return 0, ErrNotSupported
+}
+
+func (self *writeFile) Readdir(_ int) ([]fs.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+func (self *writeFile) Stat() (fs.FileInfo, error) {
+	return &writeInfo{file: self}, nil
+}
+
+func (self *writeFile) Close() error {
+	if self.failed {
+		return nil
+	}
+
+	return self.writer.Close()
+}
+
+// writeInfo describes a file that is still being uploaded.
+type writeInfo struct {
+	file *writeFile
+}
+
+func (self *writeInfo) Name() string {
+	return self.file.name
+}
+
+func (self *writeInfo) Size() int64 {
+	return self.file.writer.Size()
+}
+
+func (self *writeInfo) Mode() fs.FileMode {
+	return 0644
+}
+
+func (self *writeInfo) ModTime() time.Time {
+	return self.file.writer.ModTime()
+}
+
+func (self *writeInfo) IsDir() bool {
+	return false
+}
+
+func (self *writeInfo) Sys() any {
+	return nil
+}
@@ -26,6 +26,7 @@ var (
 )
 
 var _ io.Writer = &FileWriter{}
+var _ io.ReaderFrom = &FileWriter{}
 var _ io.Closer = &FileWriter{}
 
 type FileWriter struct {
@@ -36,14 +37,19 @@ type FileWriter struct {
 	ctx context.Context
 
 	client *proton.Client
-	events *EventLoop
+	links  *Links
+	fs     *FileSystem
 
 	parent     *Link
+	name       string
+	mimeType   string
 	linkID     string
 	revisionID string
 
 	newFile bool
 
+	expectedRevisionID string
+
 	keyring    *crypto.KeyRing
 	sessionKey *crypto.SessionKey
 
@@ -61,6 +67,8 @@ type FileWriter struct {
 	contentSize    int64
 	contentHash    hash.Hash
 	contentModTime time.Time
+
+	link *Link
 }
 
 func (self *FileWriter) allocateState() {
@@ -72,8 +80,17 @@ func (self *FileWriter) allocateState() {
 	self.blockSizes = []int64{}
 	self.blockHashes = []byte{}
 
-	self.contentSize = 0
-	self.contentHash = sha1.New()
+	// The size and hash describe the committed content and stay available after the block state is released
+	if self.contentHash == nil {
+		self.contentSize = 0
+		self.contentHash = sha1.New()
+	}
+}
+
+func (self *FileWriter) releaseState() {
+	self.blockData = nil
+	self.blockSizes = nil
+	self.blockHashes = nil
 }
 
 func (self *FileWriter) Write(buffer []byte) (int, error) {
@@ -112,7 +129,70 @@ func (self *FileWriter) Write(buffer []byte) (int, error) {
 	return len(buffer), nil
 }
 
+func (self *FileWriter) ReadFrom(reader io.Reader) (int64, error) {
+	self.allocateState()
+
+	total := int64(0)
+
+	for {
+		n, err := reader.Read(self.blockData[self.blockSize:])
+
+		self.contentSize += int64(n)
+		self.contentHash.Write(self.blockData[self.blockSize : self.blockSize+n])
+
+		total += int64(n)
+		self.blockSize += n
+
+		if self.blockSize == BlockSize {
+			err := self.uploadCurrentBlock()
+			if err != nil {
+				return total, self.handleError(err)
+			}
+
+			self.blockIndex++
+			self.blockSize = 0
+		}
+
+		if err == io.EOF {
+			return total, nil
+		}
+
+		if err != nil {
+			return total, self.handleError(err)
+		}
+	}
+}
+
+func (self *FileWriter) createFile() error {
+	if self.linkID != "" {
+		return nil
+	}
+
+	mimeType := self.mimeType
+	if mimeType == "" {
+		mimeType = detectMIMEType(self.name, self.blockData[:self.blockSize])
+	}
+
+	lid, rid, keyring, sessionKey, err := self.fs.createFile(self.ctx, self.parent, self.name, mimeType)
+	if err != nil {
+		return err
+	}
+
+	self.linkID = lid
+	self.revisionID = rid
+	self.mimeType = mimeType
+	self.keyring = keyring
+	self.sessionKey = sessionKey
+
+	return nil
+}
+
 func (self *FileWriter) uploadCurrentBlock() error {
+	err := self.createFile()
+	if err != nil {
+		return err
+	}
+
 	share := self.parent.Share()
 	data := self.blockData[:self.blockSize]
 
@@ -209,12 +289,19 @@ func (self *FileWriter) uploadCurrentBlock() error {
 	return nil
 }
 
+// Close commits the revision. Use Commit instead if you need the resulting link.
 func (self *FileWriter) Close() error {
+	_, err := self.Commit()
+	return err
+}
+
+// Commit uploads the remaining data, commits the revision and returns the updated link.
+func (self *FileWriter) Commit() (*Link, error) {
 	self.allocateState()
 
 	err := self.uploadCurrentBlock()
 	if err != nil {
-		return self.handleError(err)
+		return nil, self.handleError(err)
 	}
 
 	share := self.parent.Share()
@@ -222,12 +309,12 @@ func (self *FileWriter) Close() error {
 
 	signature, err := address.Keyring().SignDetached(crypto.NewPlainMessage(self.blockHashes))
 	if err != nil {
-		return self.handleError(err)
+		return nil, self.handleError(err)
 	}
 
 	signatureString, err := signature.GetArmored()
 	if err != nil {
-		return self.handleError(err)
+		return nil, self.handleError(err)
 	}
 
 	request := proton.CommitRevisionReq{
@@ -246,25 +333,62 @@ func (self *FileWriter) Close() error {
 
 	err = request.SetEncXAttrString(address.Keyring(), self.keyring, &xAttr)
 	if err != nil {
-		return self.handleError(err)
+		return nil, self.handleError(err)
+	}
+
+	err = self.checkRevision()
+	if err != nil {
+		return nil, self.handleError(err)
 	}
 
 	err = self.client.CommitRevision(self.ctx, share.ID(), self.linkID, self.revisionID, request)
 	if err != nil {
-		return self.handleError(err)
+		return nil, self.handleError(err)
 	}
 
-	self.blockData = nil
-	self.blockSizes = nil
-	self.blockHashes = nil
+	self.releaseState()
+
+	link, err := self.links.Refresh(self.ctx, share, self.linkID)
+	if err != nil {
+		return nil, err
+	}
+
+	self.link = link
+	return link, nil
+}
+
+// Abort discards the data that was written so far. If the file was created by this writer, it is deleted as well.
+func (self *FileWriter) Abort() error {
+	_ = self.handleError(nil)
+	self.releaseState()
+
+	return nil
+}
+
+func (self *FileWriter) checkRevision() error {
+	if self.expectedRevisionID == "" {
+		return nil
+	}
+
+	link, err := self.client.GetLink(self.ctx, self.parent.Share().ID(), self.linkID)
+	if err != nil {
+		return err
+	}
+
+	if link.FileProperties == nil || link.FileProperties.ActiveRevision.ID != self.expectedRevisionID {
+		return ErrRevisionConflict
+	}
 
-	self.events.TriggerUpdate()
 	return nil
 }
 
 func (self *FileWriter) handleError(err error) error {
 	share := self.parent.Share()
 
+	if self.linkID == "" {
+		return err
+	}
+
 	if self.newFile {
 		_ = self.client.DeleteChildren(self.ctx, share.ID(), self.parent.ID(), self.linkID)
 	} else {
@@ -274,12 +398,32 @@ func (self *FileWriter) handleError(err error) error {
 	return err
 }
 
+func (self *FileWriter) LinkID() string {
+	return self.linkID
+}
+
+func (self *FileWriter) RevisionID() string {
+	return self.revisionID
+}
+
+// Link returns the link of the file after the revision has been committed.
+func (self *FileWriter) Link() *Link {
+	return self.link
+}
+
+func (self *FileWriter) MIMEType() string {
+	return self.mimeType
+}
+
 func (self *FileWriter) Size() int64 {
 	return self.contentSize
 }
 
 func (self *FileWriter) Hash() string {
-	self.allocateState()
+	if self.contentHash == nil {
+		self.contentHash = sha1.New()
+	}
+
 	return hex.EncodeToString(self.contentHash.Sum(nil))
 }
 
@@ -0,0 +1,43 @@
+package drive
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"testing"
+)
+
+func TestFileWriterHashAfterRelease(t *testing.T) {
+	data := []byte("hello world")
+
+	sum := sha1.Sum(data)
+	expected := hex.EncodeToString(sum[:])
+
+	writer := &FileWriter{}
+
+	_, err := writer.Write(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Commit and Abort release the block state once the revision is done
+	writer.releaseState()
+
+	if hash := writer.Hash(); hash != expected {
+		t.Errorf("hash after release: got %s, want %s", hash, expected)
+	}
+
+	if size := writer.Size(); size != int64(len(data)) {
+		t.Errorf("size after release: got %d, want %d", size, len(data))
+	}
+}
+
+func TestFileWriterHashEmpty(t *testing.T) {
+	sum := sha1.Sum(nil)
+	expected := hex.EncodeToString(sum[:])
+
+	writer := &FileWriter{}
+
+	if hash := writer.Hash(); hash != expected {
+		t.Errorf("got %s, want %s", hash, expected)
+	}
+}